@@ -0,0 +1,83 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// slices as temporary tables
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// ArrayTable creates a temporary table with the given name holding the
+// values of a slice ([]int64, []float64 or []string) in a single column
+// named value, e.g.
+//
+//	cleanup, err := cn.ArrayTable("ids", []int64{1, 2, 3})
+//	...
+//	defer cleanup()
+//	rows, err := db.Query("select t.* from t join ids on t.id = ids.value")
+//
+// as an alternative to a long IN list. The table is local to the
+// connection and is not affected by commits and rollbacks. cleanup drops
+// it. Temporary tables have no owner so the name cannot be qualified
+// with one (such as dba.ids).
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) ArrayTable(name string, values interface{}) (cleanup func(), err error) {
+	if strings.Contains(name, ".") {
+		return nil, fmt.Errorf("sqla: array table %q cannot be qualified with an owner", name)
+	}
+	var coltype string
+	var vals []driver.Value
+	switch v := values.(type) {
+	case []int64:
+		coltype = "BIGINT"
+		for _, x := range v {
+			vals = append(vals, x)
+		}
+	case []float64:
+		coltype = "DOUBLE"
+		for _, x := range v {
+			vals = append(vals, x)
+		}
+	case []string:
+		coltype = "LONG VARCHAR"
+		for _, x := range v {
+			vals = append(vals, x)
+		}
+	default:
+		return nil, fmt.Errorf("sqla: unsupported array table type %T", values)
+	}
+	table := QuoteIdentifier(name)
+	err = cn.cn.executeImmediate(fmt.Sprintf(
+		"DECLARE LOCAL TEMPORARY TABLE %s (value %s) NOT TRANSACTIONAL", table, coltype))
+	if err != nil {
+		return nil, err
+	}
+	cleanup = func() {
+		if err := cn.cn.executeImmediate("DROP TABLE " + table); err != nil {
+			cn.cfg.logger().Print("sqla: failed to drop array table ", name, ": ", err)
+		}
+	}
+	if err = cn.fillArrayTable(table, vals); err != nil {
+		cleanup()
+		return nil, err
+	}
+	return cleanup, nil
+}
+
+func (cn *conn) fillArrayTable(table string, vals []driver.Value) error {
+	s, err := cn.Prepare("INSERT INTO " + table + " VALUES (?)")
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for _, v := range vals {
+		if _, err = s.Exec([]driver.Value{v}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// features of the client library
+
+// ClientCapabilities lists the optional features supported by the
+// client library (dbcapi.dll) the driver has been loaded with
+type ClientCapabilities struct {
+	// Version of the C API the client library has been initialized with
+	// (the highest one both the driver and the library support)
+	APIVersion int
+	// Version of the client library such as 17.0.10.6285 (empty if it
+	// could not be determined)
+	ClientVersion string
+	// Statements can be canceled while they run once their context is
+	// done (and fetches once Config.FetchTimeout has passed). Without it
+	// they run to completion.
+	Cancel bool
+	// float32 values are bound as REAL rather than converted to DOUBLE
+	Float32 bool
+}
+
+// determined once the client library has been initialized
+var capabilities ClientCapabilities
+
+func newCapabilities(apiVersion int, version string) ClientCapabilities {
+	if apiVersion < API_VERSION_1 {
+		// the client library did not report its version
+		apiVersion = API_VERSION_1
+	}
+	return ClientCapabilities{
+		APIVersion:    apiVersion,
+		ClientVersion: version,
+		Cancel:        apiVersion >= API_VERSION_2,
+		Float32:       apiVersion >= API_VERSION_5,
+	}
+}
+
+// Capabilities reports the optional features supported by the client
+// library the driver has been loaded with
+func Capabilities() ClientCapabilities {
+	return capabilities
+}
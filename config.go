@@ -0,0 +1,733 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// connection string handling
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Config describes a connection to the server.
+//
+// Connection string format is the format ubiquitously accepted by SQLA
+// toolset:
+//
+//	attr1=value1;attr2=value2...
+//
+// Driver-specific options use the same syntax and are stripped from the
+// connection string before it is passed on to the server.
+type Config struct {
+	// SQL Anywhere connection parameters, passed to the server verbatim
+	// and in order
+	Params []Param
+
+	// Character set to request for the connection (`charset`/`cs`).
+	// If empty, utf8 is requested and the effective character set is
+	// queried from the server after connecting.
+	// If set, the value is trusted and no query is issued.
+	CharSet string
+
+	// Verify the server can be reached when connecting (the `ping`
+	// connection parameter)
+	Ping bool
+
+	// Compress the communication with the server (`compress`/`comp`).
+	// Trades CPU time on both ends for less bandwidth - worth it on slow
+	// links, usually slower on a LAN.
+	Compress bool
+
+	// Packets smaller than this are sent uncompressed
+	// (`compressionthreshold`/`cth`, accepts KB/MB suffixes).
+	// Only used with Compress, the server default (120 bytes) if zero.
+	CompressionThreshold int
+
+	// Encryption of the connection (`encryption`/`enc`), see Encryption.
+	// Not encrypted if nil.
+	Encryption *Encryption
+
+	// Do not query the effective character set after connecting
+	// (`skip_charset_query`)
+	SkipCharSetQuery bool
+
+	// String and binary parameters larger than this are sent to the
+	// server in chunks of this size rather than in a single buffer
+	// (`max_inline_param`, accepts KB/MB suffixes).
+	// Defaults to 64KB.
+	MaxInlineParam int
+
+	// Maximum number of parameters of a statement (`max_params`).
+	// Preparing a statement with more parameters fails rather than
+	// pinning a bind buffer for each of them.
+	// Defaults to 32767.
+	MaxParams int
+
+	// Initial size of the per-column buffers string and binary values
+	// are copied into when fetching rows (`fetch_buffer_size`, accepts
+	// KB/MB suffixes).
+	// The buffers are reused across the rows of a result set and grow
+	// as needed so a larger size trades memory held per column for fewer
+	// reallocations on wide columns.
+	// By default buffers are sized after the first value fetched.
+	FetchBufferSize int
+
+	// Statements taking longer than this to execute and fetch are logged
+	// with Logger (`slow_query_threshold`, a Go duration such as 500ms).
+	// Disabled if zero.
+	SlowQueryThreshold time.Duration
+
+	// Fetching a row (in Next or FetchAt) taking longer than this is canceled on the
+	// server and fails with ErrFetchTimeout (`fetch_timeout`, a Go
+	// duration such as 30s). Protects loops over rows whose computation
+	// stalls after the query has been opened. Disabled if zero or if
+	// the client library cannot cancel (see Capabilities).
+	FetchTimeout time.Duration
+
+	// Go layout time.Time parameters are formatted with before they are
+	// sent to the server (`timestamp_format`).
+	// Defaults to 2006-01-02 15:04:05.000000.
+	TimestampFormat string
+
+	// Value of the date_format server option set for the connection
+	// when connecting (`date_format`) such as YYYY-MM-DD. Affects the
+	// text of DATE values converted to strings by the server - DATE
+	// columns not in the default format are returned as strings rather
+	// than time.Time.
+	DateFormat string
+
+	// Value of the date_order server option set for the connection when
+	// connecting (`date_order`): MDY, DMY or YMD. Decides how ambiguous
+	// date literals such as 01/02/2020 are interpreted by the server.
+	// time.Time parameters are not affected (see TimestampFormat).
+	DateOrder string
+
+	// Time zone time.Time parameters are converted to before they are
+	// formatted and DATE/TIME/TIMESTAMP values read are in
+	// (`location`, a name such as Europe/Berlin). Defaults to UTC.
+	Location *time.Location
+
+	// Query returning the last value generated for an identity
+	// (autoincrement) column on the connection which LastInsertId runs
+	// (`identity_query`). Defaults to SELECT @@identity.
+	IdentityQuery string
+
+	// Isolation level set for the connection when connecting
+	// (`isolation`): sql.LevelReadUncommitted (read_uncommitted or 0),
+	// sql.LevelReadCommitted (read_committed or 1), sql.LevelRepeatableRead
+	// (repeatable_read or 2), sql.LevelSerializable (serializable or 3) or
+	// sql.LevelSnapshot (snapshot, requires the allow_snapshot_isolation
+	// database option).
+	// The server default (the isolation_level option) is used if
+	// sql.LevelDefault.
+	DefaultIsolation sql.IsolationLevel
+
+	// Remove trailing spaces from the values of CHAR and NCHAR columns
+	// (`trim_char`). VARCHAR values are returned as stored.
+	TrimChar bool
+
+	// Return the values of BIT columns as bool rather than uint8
+	// (`bit_as_bool`). Off by default as bool values cannot be scanned
+	// into integers.
+	BitAsBool bool
+
+	// Return the values of character columns as []byte rather than
+	// string (`strings_as_bytes`) which saves copying each value into a
+	// new string. The values can still be scanned into strings but are
+	// []byte when scanned into interface{}.
+	StringsAsBytes bool
+
+	// Describe the result set columns of a prepared statement when they
+	// are first needed rather than when preparing it (`lazy_columns`).
+	// Saves the round-trips for statements whose result set is never
+	// read (such as the ones only executed with Exec).
+	LazyColumns bool
+
+	// Apply Unicode normalization form C (NFC) to string parameters
+	// before they are bound and to the values of character columns
+	// (`normalize_unicode`) so that differently composed forms of the
+	// same text (such as an e followed by a combining acute accent and
+	// a precomposed é) are stored and compared as one.
+	NormalizeUnicode bool
+
+	// Only run queries (SELECT and WITH statements) on the connection
+	// (`readonly`), e.g. for connections to a read replica. Any other
+	// statement fails with ErrReadOnly before it is sent to the server.
+	// SQL Anywhere has no read-only connection mode so unless the
+	// database has been started read-only (which is checked when
+	// connecting and logged if not) this is enforced by the driver and
+	// does not cover the writes of procedures or functions called by a
+	// query.
+	ReadOnly bool
+
+	// Do not let database/sql check the number of arguments of a statement
+	// against its parameters (`skip_arg_count`) so that a []interface{}
+	// argument can cover several placeholders, e.g. the flattened values
+	// of a multi-row VALUES clause. The driver still checks the count
+	// once the arguments have been flattened. Off by default so that
+	// database/sql checks the count strictly.
+	SkipArgCount bool
+
+	// Bind zero time.Time values as NULL rather than 0001-01-01
+	// (`zero_time_as_null`)
+	ZeroTimeAsNull bool
+
+	// Number of idle prepared statements kept per connection (`stmt_cache`).
+	// Statements closed by database/sql (including the ones it prepares
+	// implicitly for Query and Exec) stay prepared and are handed out
+	// again when the same query is prepared on the connection.
+	// The parameter and column metadata of as many queries is shared by
+	// all connections of a connector so that a query prepared on a new
+	// connection is not described again.
+	// Disabled if zero.
+	StmtCache int
+
+	// OnStmtEvict is called with the query of each statement evicted
+	// from the statement cache (and freed) to make room for another one
+	// so that the cache churn can be tracked. It is called once the
+	// statement which took its place has been closed, outside of any
+	// driver lock, and should return quickly.
+	// Can only be set with NewConnector.
+	OnStmtEvict func(query string)
+
+	// Re-run queries on another connection if the connection is lost
+	// before the first row has been fetched (`retry_idempotent`).
+	// The first row is fetched when the query is opened so that the
+	// failure can be reported to database/sql which retries the query.
+	// Only safe if all queries are idempotent - a query which modifies
+	// data (such as a procedure call) may run twice.
+	RetryIdempotent bool
+
+	// Cursor type of queries (`cursor`): CursorDefault or
+	// CursorFastForwardReadOnly
+	Cursor string
+
+	// Go type DECIMAL/NUMERIC (and MONEY) values are returned as
+	// (`decimal_as`): DecimalAsString (string, the exact textual form)
+	// or DecimalAsFloat (float64). float64 holds 15 to 17 significant
+	// digits - values with more are converted as per DecimalRounding.
+	DecimalAs string
+
+	// How DECIMAL values with more significant digits than float64 can
+	// hold are converted with DecimalAsFloat (`decimal_rounding`):
+	// DecimalRound (to the nearest float64) or DecimalTruncate (to the
+	// nearest float64 toward zero, never increasing the magnitude).
+	DecimalRounding string
+
+	// Log the size of each bind parameter buffer when it is bound and
+	// how long it was kept alive once it is released (`debug_bind_buffers`).
+	// Meant for diagnosing buffers freed while the native side still
+	// uses them - it is off by default and costs nothing then.
+	DebugBindBuffers bool
+
+	// Keep a copy of the bytes of each value of the current row as
+	// received from the client library - in the connection character
+	// set before any conversion by the driver - for RawColumn
+	// (`raw_column_dump`). Meant for diagnosing character set problems -
+	// it is off by default and costs nothing then.
+	RawColumnDump bool
+
+	// Logger receives the messages logged by the driver.
+	// Defaults to the standard logger of the log package.
+	// Can only be set with NewConnector.
+	Logger Logger
+}
+
+// Logger is implemented by *log.Logger
+type Logger interface {
+	Print(v ...interface{})
+}
+
+type stdLogger struct{}
+
+func (stdLogger) Print(v ...interface{}) {
+	log.Print(v...)
+}
+
+const defaultMaxInlineParam = 64 << 10
+
+const defaultMaxParams = 32767
+
+const defaultTimestampFormat = "2006-01-02 15:04:05.000000"
+
+const defaultIdentityQuery = "SELECT @@identity"
+
+// cursor types (see Config.Cursor)
+const (
+	CursorDefault = ""
+	// forward-only, read-only cursors which let the server discard rows
+	// once fetched (faster large scans, no FetchAt)
+	CursorFastForwardReadOnly = "fast_forward_readonly"
+)
+
+// types DECIMAL values are returned as (see Config.DecimalAs)
+const (
+	DecimalAsString = ""
+	DecimalAsFloat  = "float"
+)
+
+// conversions of DECIMAL values to float64 (see Config.DecimalRounding)
+const (
+	DecimalRound    = ""
+	DecimalTruncate = "truncate"
+)
+
+// Param is a single SQL Anywhere connection parameter
+type Param struct {
+	Name  string
+	Value string
+}
+
+// driver-specific connection string options
+const (
+	optSkipCharSetQuery = "skip_charset_query"
+	optMaxInlineParam   = "max_inline_param"
+	optMaxParams        = "max_params"
+	optFetchBufferSize  = "fetch_buffer_size"
+	optSlowQuery        = "slow_query_threshold"
+	optFetchTimeout     = "fetch_timeout"
+	optZeroTimeAsNull   = "zero_time_as_null"
+	optTrimChar         = "trim_char"
+	optBitAsBool        = "bit_as_bool"
+	optLazyColumns      = "lazy_columns"
+	optStringsAsBytes   = "strings_as_bytes"
+	optNormalizeUnicode = "normalize_unicode"
+	optReadOnly         = "readonly"
+	optSkipArgCount     = "skip_arg_count"
+	optDecimalAs        = "decimal_as"
+	optDecimalRounding  = "decimal_rounding"
+	optStmtCache        = "stmt_cache"
+	optCursor           = "cursor"
+	optIsolation        = "isolation"
+	optTimestampFormat  = "timestamp_format"
+	optDateFormat       = "date_format"
+	optDateOrder        = "date_order"
+	optIdentityQuery    = "identity_query"
+	optLocation         = "location"
+	optRetryIdempotent  = "retry_idempotent"
+	optDebugBindBuffers = "debug_bind_buffers"
+	optRawColumnDump    = "raw_column_dump"
+)
+
+// ParseDSN parses the connection string into a Config
+func ParseDSN(dsn string) (*Config, error) {
+	cfg := &Config{}
+	for _, attr := range splitDSN(dsn) {
+		attr = strings.TrimSpace(attr)
+		if attr == "" {
+			continue
+		}
+		i := strings.IndexByte(attr, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("sqla: invalid connection parameter %q", attr)
+		}
+		name := strings.TrimSpace(attr[:i])
+		value := unquoteValue(strings.TrimSpace(attr[i+1:]))
+		var err error
+		switch strings.ToLower(name) {
+		case "charset", "cs":
+			cfg.CharSet = value
+		case "ping":
+			cfg.Ping, err = parseBool(value)
+		case "compress", "comp":
+			cfg.Compress, err = parseBool(value)
+		case "compressionthreshold", "cth":
+			cfg.CompressionThreshold, err = parseSize(value)
+		case "encryption", "enc":
+			cfg.Encryption, err = parseEncryption(value)
+		case optSkipCharSetQuery:
+			cfg.SkipCharSetQuery, err = parseBool(value)
+		case optMaxInlineParam:
+			cfg.MaxInlineParam, err = parseSize(value)
+		case optMaxParams:
+			cfg.MaxParams, err = strconv.Atoi(value)
+		case optFetchBufferSize:
+			cfg.FetchBufferSize, err = parseSize(value)
+		case optSlowQuery:
+			cfg.SlowQueryThreshold, err = time.ParseDuration(value)
+		case optFetchTimeout:
+			cfg.FetchTimeout, err = time.ParseDuration(value)
+		case optTimestampFormat:
+			cfg.TimestampFormat = value
+		case optLocation:
+			cfg.Location, err = time.LoadLocation(value)
+		case optIdentityQuery:
+			cfg.IdentityQuery = value
+		case optDateFormat:
+			cfg.DateFormat = value
+		case optDateOrder:
+			cfg.DateOrder = strings.ToUpper(value)
+		case optZeroTimeAsNull:
+			cfg.ZeroTimeAsNull, err = parseBool(value)
+		case optTrimChar:
+			cfg.TrimChar, err = parseBool(value)
+		case optBitAsBool:
+			cfg.BitAsBool, err = parseBool(value)
+		case optStringsAsBytes:
+			cfg.StringsAsBytes, err = parseBool(value)
+		case optLazyColumns:
+			cfg.LazyColumns, err = parseBool(value)
+		case optNormalizeUnicode:
+			cfg.NormalizeUnicode, err = parseBool(value)
+		case optReadOnly:
+			cfg.ReadOnly, err = parseBool(value)
+		case optSkipArgCount:
+			cfg.SkipArgCount, err = parseBool(value)
+		case optStmtCache:
+			cfg.StmtCache, err = parseCount(value)
+		case optRetryIdempotent:
+			cfg.RetryIdempotent, err = parseBool(value)
+		case optIsolation:
+			cfg.DefaultIsolation, err = parseIsolation(value)
+		case optDebugBindBuffers:
+			cfg.DebugBindBuffers, err = parseBool(value)
+		case optRawColumnDump:
+			cfg.RawColumnDump, err = parseBool(value)
+		case optDecimalAs:
+			switch cfg.DecimalAs = strings.ToLower(value); cfg.DecimalAs {
+			case "string":
+				cfg.DecimalAs = DecimalAsString
+			case DecimalAsString, DecimalAsFloat:
+			default:
+				err = fmt.Errorf("unknown decimal type %q", value)
+			}
+		case optDecimalRounding:
+			switch cfg.DecimalRounding = strings.ToLower(value); cfg.DecimalRounding {
+			case "round":
+				cfg.DecimalRounding = DecimalRound
+			case DecimalRound, DecimalTruncate:
+			default:
+				err = fmt.Errorf("unknown decimal rounding %q", value)
+			}
+		case optCursor:
+			switch cfg.Cursor = strings.ToLower(value); cfg.Cursor {
+			case CursorDefault, CursorFastForwardReadOnly:
+			default:
+				err = fmt.Errorf("unknown cursor type %q", value)
+			}
+		default:
+			cfg.Params = append(cfg.Params, Param{Name: name, Value: value})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sqla: invalid value for %s: %v", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// FormatDSN formats the configuration as a connection string which can
+// be parsed back with ParseDSN
+func (cfg *Config) FormatDSN() string {
+	attrs := cfg.serverParams()
+	if cfg.SkipCharSetQuery {
+		attrs = append(attrs, optSkipCharSetQuery+"=yes")
+	}
+	if cfg.MaxInlineParam > 0 {
+		attrs = append(attrs, optMaxInlineParam+"="+strconv.Itoa(cfg.MaxInlineParam))
+	}
+	if cfg.MaxParams > 0 {
+		attrs = append(attrs, optMaxParams+"="+strconv.Itoa(cfg.MaxParams))
+	}
+	if cfg.FetchBufferSize > 0 {
+		attrs = append(attrs, optFetchBufferSize+"="+strconv.Itoa(cfg.FetchBufferSize))
+	}
+	if cfg.SlowQueryThreshold > 0 {
+		attrs = append(attrs, optSlowQuery+"="+cfg.SlowQueryThreshold.String())
+	}
+	if cfg.FetchTimeout > 0 {
+		attrs = append(attrs, optFetchTimeout+"="+cfg.FetchTimeout.String())
+	}
+	if cfg.TimestampFormat != "" {
+		attrs = append(attrs, optTimestampFormat+"="+quoteValue(cfg.TimestampFormat))
+	}
+	if cfg.Location != nil {
+		attrs = append(attrs, optLocation+"="+cfg.Location.String())
+	}
+	if cfg.IdentityQuery != "" {
+		attrs = append(attrs, optIdentityQuery+"="+quoteValue(cfg.IdentityQuery))
+	}
+	if cfg.DateFormat != "" {
+		attrs = append(attrs, optDateFormat+"="+quoteValue(cfg.DateFormat))
+	}
+	if cfg.DateOrder != "" {
+		attrs = append(attrs, optDateOrder+"="+cfg.DateOrder)
+	}
+	if cfg.ZeroTimeAsNull {
+		attrs = append(attrs, optZeroTimeAsNull+"=yes")
+	}
+	if cfg.TrimChar {
+		attrs = append(attrs, optTrimChar+"=yes")
+	}
+	if cfg.BitAsBool {
+		attrs = append(attrs, optBitAsBool+"=yes")
+	}
+	if cfg.StringsAsBytes {
+		attrs = append(attrs, optStringsAsBytes+"=yes")
+	}
+	if cfg.LazyColumns {
+		attrs = append(attrs, optLazyColumns+"=yes")
+	}
+	if cfg.NormalizeUnicode {
+		attrs = append(attrs, optNormalizeUnicode+"=yes")
+	}
+	if cfg.ReadOnly {
+		attrs = append(attrs, optReadOnly+"=yes")
+	}
+	if cfg.SkipArgCount {
+		attrs = append(attrs, optSkipArgCount+"=yes")
+	}
+	if cfg.StmtCache > 0 {
+		attrs = append(attrs, optStmtCache+"="+strconv.Itoa(cfg.StmtCache))
+	}
+	if cfg.RetryIdempotent {
+		attrs = append(attrs, optRetryIdempotent+"=yes")
+	}
+	if cfg.Cursor != CursorDefault {
+		attrs = append(attrs, optCursor+"="+cfg.Cursor)
+	}
+	if cfg.DecimalAs != DecimalAsString {
+		attrs = append(attrs, optDecimalAs+"="+cfg.DecimalAs)
+	}
+	if cfg.DecimalRounding != DecimalRound {
+		attrs = append(attrs, optDecimalRounding+"="+cfg.DecimalRounding)
+	}
+	if cfg.DebugBindBuffers {
+		attrs = append(attrs, optDebugBindBuffers+"=yes")
+	}
+	if cfg.RawColumnDump {
+		attrs = append(attrs, optRawColumnDump+"=yes")
+	}
+	if cfg.DefaultIsolation != sql.LevelDefault {
+		attrs = append(attrs, optIsolation+"="+isolationName(cfg.DefaultIsolation))
+	}
+	return strings.Join(attrs, ";")
+}
+
+func (cfg *Config) logger() Logger {
+	if cfg.Logger != nil {
+		return cfg.Logger
+	}
+	return stdLogger{}
+}
+
+func (cfg *Config) maxInlineParam() int {
+	if cfg.MaxInlineParam > 0 {
+		return cfg.MaxInlineParam
+	}
+	return defaultMaxInlineParam
+}
+
+func (cfg *Config) maxParams() int {
+	if cfg.MaxParams > 0 {
+		return cfg.MaxParams
+	}
+	return defaultMaxParams
+}
+
+func (cfg *Config) timestampFormat() string {
+	if cfg.TimestampFormat != "" {
+		return cfg.TimestampFormat
+	}
+	return defaultTimestampFormat
+}
+
+func (cfg *Config) location() *time.Location {
+	if cfg.Location != nil {
+		return cfg.Location
+	}
+	return time.UTC
+}
+
+func (cfg *Config) identityQuery() string {
+	if cfg.IdentityQuery != "" {
+		return cfg.IdentityQuery
+	}
+	return defaultIdentityQuery
+}
+
+// checks that the timestamp format keeps the date and time of day (to
+// the second) by formatting a sample value and parsing it back
+func (cfg *Config) validateTimestampFormat() error {
+	layout := cfg.timestampFormat()
+	sample := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	parsed, err := time.Parse(layout, sample.Format(layout))
+	if err != nil || !parsed.Equal(sample) {
+		return fmt.Errorf("sqla: invalid timestamp format %q", layout)
+	}
+	return nil
+}
+
+// checks that the date format has the year, month and day (or day of
+// the year) and no symbols other than the ones of the date_format
+// option and that the date order is known
+func (cfg *Config) validateDateOptions() error {
+	if f := strings.ToUpper(cfg.DateFormat); f != "" {
+		valid := strings.Contains(f, "YY") && strings.Contains(f, "MM") &&
+			(strings.Contains(f, "DD") || strings.Contains(f, "JJJ"))
+		for _, r := range f {
+			if unicode.IsLetter(r) && !strings.ContainsRune("YMDJ", r) {
+				valid = false
+			}
+		}
+		if !valid {
+			return fmt.Errorf("sqla: invalid date format %q", cfg.DateFormat)
+		}
+	}
+	switch strings.ToUpper(cfg.DateOrder) {
+	case "", "MDY", "DMY", "YMD":
+	default:
+		return fmt.Errorf("sqla: unknown date order %q", cfg.DateOrder)
+	}
+	return nil
+}
+
+// supported isolation levels and the values of the isolation_level
+// option they are set with
+var isolationOptions = map[sql.IsolationLevel]string{
+	sql.LevelReadUncommitted: "0",
+	sql.LevelReadCommitted:   "1",
+	sql.LevelRepeatableRead:  "2",
+	sql.LevelSerializable:    "3",
+	sql.LevelSnapshot:        "snapshot",
+}
+
+// name of the level in a connection string (such as read_committed)
+func isolationName(level sql.IsolationLevel) string {
+	return strings.ToLower(strings.Replace(level.String(), " ", "_", -1))
+}
+
+func parseIsolation(v string) (sql.IsolationLevel, error) {
+	for level, opt := range isolationOptions {
+		if strings.EqualFold(v, isolationName(level)) || strings.EqualFold(v, opt) {
+			return level, nil
+		}
+	}
+	return sql.LevelDefault, fmt.Errorf("unknown isolation level %q", v)
+}
+
+// connection string as passed to the server
+func (cfg *Config) connString() string {
+	attrs := cfg.serverParams()
+	if cfg.CharSet == "" {
+		// [ap]: augment the connection options string to instruct the server
+		// to perform character set conversions and return strings in utf-8
+		attrs = append(attrs, "cs=utf8")
+	}
+	return strings.Join(attrs, ";")
+}
+
+func (cfg *Config) serverParams() []string {
+	attrs := make([]string, 0, len(cfg.Params)+1)
+	for _, p := range cfg.Params {
+		attrs = append(attrs, p.Name+"="+quoteValue(p.Value))
+	}
+	if cfg.CharSet != "" {
+		attrs = append(attrs, "cs="+quoteValue(cfg.CharSet))
+	}
+	if cfg.Ping {
+		attrs = append(attrs, "ping=yes")
+	}
+	if cfg.Compress {
+		attrs = append(attrs, "compress=yes")
+	}
+	if cfg.CompressionThreshold > 0 {
+		attrs = append(attrs, "cth="+strconv.Itoa(cfg.CompressionThreshold))
+	}
+	if cfg.Encryption != nil {
+		attrs = append(attrs, "enc="+cfg.Encryption.String())
+	}
+	return attrs
+}
+
+// splits the connection string on `;` ignoring separators enclosed in
+// braces, quotes or parentheses (as in `links=tcpip(host=a;port=2638)`)
+func splitDSN(dsn string) (attrs []string) {
+	var depth int
+	var quote byte
+	start := 0
+	for i := 0; i < len(dsn); i++ {
+		c := dsn[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '{':
+			depth++
+		case c == ')' || c == '}':
+			if depth > 0 {
+				depth--
+			}
+		case c == ';' && depth == 0:
+			attrs = append(attrs, dsn[start:i])
+			start = i + 1
+		}
+	}
+	return append(attrs, dsn[start:])
+}
+
+func unquoteValue(v string) string {
+	if len(v) >= 2 {
+		switch {
+		case v[0] == '{' && v[len(v)-1] == '}',
+			v[0] == '"' && v[len(v)-1] == '"',
+			v[0] == '\'' && v[len(v)-1] == '\'':
+			return v[1 : len(v)-1]
+		}
+	}
+	return v
+}
+
+func quoteValue(v string) string {
+	if strings.IndexByte(v, ';') < 0 || strings.IndexByte(v, '(') >= 0 {
+		return v
+	}
+	return "{" + v + "}"
+}
+
+func parseBool(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "yes", "y", "true", "on", "1":
+		return true, nil
+	case "no", "n", "false", "off", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("not a boolean: %q", v)
+}
+
+// parses a non-negative number
+func parseCount(v string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("not a count: %q", v)
+	}
+	return n, nil
+}
+
+// parses a size in bytes with an optional KB/MB/GB suffix
+func parseSize(v string) (int, error) {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	mult := 1
+	for _, unit := range []struct {
+		suffix string
+		mult   int
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(s[:len(s)-len(unit.suffix)])
+			mult = unit.mult
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("not a size: %q", v)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,256 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDSN(t *testing.T) {
+	cfg, err := ParseDSN("uid=dba;pwd={se;cret};links=tcpip(host=a;port=2638);CS=cp1252;skip_charset_query=yes;zero_time_as_null=on;trim_char=yes;bit_as_bool=yes;lazy_columns=yes;strings_as_bytes=yes;debug_bind_buffers=yes;raw_column_dump=yes;normalize_unicode=yes;readonly=yes;skip_arg_count=yes;decimal_as=float;decimal_rounding=truncate;stmt_cache=16;fetch_timeout=30s;max_params=1000;cursor=fast_forward_readonly;retry_idempotent=yes;isolation=snapshot;timestamp_format={2006-01-02T15:04:05};identity_query={SELECT last_id()};location=Europe/Berlin;date_format=DD.MM.YYYY;date_order=dmy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Param{
+		{"uid", "dba"},
+		{"pwd", "se;cret"},
+		{"links", "tcpip(host=a;port=2638)"},
+	}
+	if !reflect.DeepEqual(cfg.Params, want) {
+		t.Fatalf("expected params %v, got %v", want, cfg.Params)
+	}
+	if cfg.CharSet != "cp1252" {
+		t.Fatalf("expected charset cp1252, got %q", cfg.CharSet)
+	}
+	if !cfg.SkipCharSetQuery {
+		t.Fatal("expected the charset query to be skipped")
+	}
+	if !cfg.ZeroTimeAsNull {
+		t.Fatal("expected zero times to be bound as NULL")
+	}
+	if !cfg.TrimChar {
+		t.Fatal("expected CHAR values to be trimmed")
+	}
+	if !cfg.BitAsBool {
+		t.Fatal("expected BIT values as bool")
+	}
+	if !cfg.StringsAsBytes {
+		t.Fatal("expected strings to be returned as bytes")
+	}
+	if !cfg.LazyColumns {
+		t.Fatal("expected lazily described columns")
+	}
+	if cfg.DecimalAs != DecimalAsFloat || cfg.DecimalRounding != DecimalTruncate {
+		t.Fatalf("expected truncated float decimals, got %q and %q", cfg.DecimalAs, cfg.DecimalRounding)
+	}
+	if !cfg.SkipArgCount {
+		t.Fatal("expected the argument count not to be checked")
+	}
+	if !cfg.ReadOnly {
+		t.Fatal("expected a read-only connection")
+	}
+	if !cfg.NormalizeUnicode {
+		t.Fatal("expected strings to be normalized")
+	}
+	if cfg.Location == nil || cfg.Location.String() != "Europe/Berlin" {
+		t.Fatalf("unexpected location %v", cfg.Location)
+	}
+	if cfg.FetchTimeout != 30*time.Second {
+		t.Fatalf("unexpected fetch timeout %s", cfg.FetchTimeout)
+	}
+	if !cfg.RawColumnDump {
+		t.Fatal("expected raw column dumps")
+	}
+	if !cfg.DebugBindBuffers {
+		t.Fatal("expected bind buffers to be logged")
+	}
+	if cfg.StmtCache != 16 {
+		t.Fatalf("expected a statement cache of 16, got %d", cfg.StmtCache)
+	}
+	if cfg.MaxParams != 1000 {
+		t.Fatalf("expected a limit of 1000 parameters, got %d", cfg.MaxParams)
+	}
+	if cfg.TimestampFormat != "2006-01-02T15:04:05" {
+		t.Fatalf("unexpected timestamp format %q", cfg.TimestampFormat)
+	}
+	if cfg.IdentityQuery != "SELECT last_id()" {
+		t.Fatalf("unexpected identity query %q", cfg.IdentityQuery)
+	}
+	if !cfg.RetryIdempotent {
+		t.Fatal("expected queries to be retried")
+	}
+	if cfg.DefaultIsolation != sql.LevelSnapshot {
+		t.Fatalf("expected snapshot isolation, got %v", cfg.DefaultIsolation)
+	}
+	if cfg.DateFormat != "DD.MM.YYYY" || cfg.DateOrder != "DMY" {
+		t.Fatalf("unexpected date options %q, %q", cfg.DateFormat, cfg.DateOrder)
+	}
+	if cfg.Cursor != CursorFastForwardReadOnly {
+		t.Fatalf("expected a fast forward cursor, got %q", cfg.Cursor)
+	}
+
+	dsn := cfg.FormatDSN()
+	cfg2, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, cfg2) {
+		t.Fatalf("%q does not round-trip: %+v != %+v", dsn, cfg, cfg2)
+	}
+}
+
+func TestParseDSNInvalid(t *testing.T) {
+	for _, dsn := range []string{"uid", "skip_charset_query=maybe", "cursor=keyset", "stmt_cache=-1",
+		"enc=aes", "isolation=chaos", "enc=simple(fips=yes)", "enc=tls(tls_type=rsa;certificate_file=x)"} {
+		if _, err := ParseDSN(dsn); err == nil {
+			t.Errorf("expected an error for %q", dsn)
+		}
+	}
+}
+
+func TestConnStringCharSet(t *testing.T) {
+	cfg, _ := ParseDSN("uid=dba")
+	if s := cfg.connString(); s != "uid=dba;cs=utf8" {
+		t.Fatalf("unexpected connection string %q", s)
+	}
+	cfg.CharSet = "cp1252"
+	if s := cfg.connString(); s != "uid=dba;cs=cp1252" {
+		t.Fatalf("unexpected connection string %q", s)
+	}
+}
+
+func TestPingParam(t *testing.T) {
+	cfg, err := ParseDSN("uid=dba;PING=YES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Ping || len(cfg.Params) != 1 {
+		t.Fatalf("expected the ping parameter to be parsed into Config.Ping, got %+v", cfg)
+	}
+	if s := cfg.FormatDSN(); s != "uid=dba;ping=yes" {
+		t.Fatalf("unexpected connection string %q", s)
+	}
+	if s := cfg.connString(); s != "uid=dba;ping=yes;cs=utf8" {
+		t.Fatalf("unexpected connection string %q", s)
+	}
+}
+
+func TestCompressParam(t *testing.T) {
+	cfg, err := ParseDSN("uid=dba;COMP=yes;cth=1KB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Compress || cfg.CompressionThreshold != 1024 || len(cfg.Params) != 1 {
+		t.Fatalf("expected the compression parameters to be parsed into the Config, got %+v", cfg)
+	}
+	if s := cfg.FormatDSN(); s != "uid=dba;compress=yes;cth=1024" {
+		t.Fatalf("unexpected connection string %q", s)
+	}
+	if s := cfg.connString(); s != "uid=dba;compress=yes;cth=1024;cs=utf8" {
+		t.Fatalf("unexpected connection string %q", s)
+	}
+}
+
+func TestParseIsolation(t *testing.T) {
+	for v, want := range map[string]sql.IsolationLevel{
+		"read_uncommitted": sql.LevelReadUncommitted,
+		"1":                sql.LevelReadCommitted,
+		"Repeatable_Read":  sql.LevelRepeatableRead,
+		"serializable":     sql.LevelSerializable,
+		"snapshot":         sql.LevelSnapshot,
+	} {
+		level, err := parseIsolation(v)
+		if err != nil || level != want {
+			t.Errorf("expected %v for %q, got %v (%v)", want, v, level, err)
+		}
+	}
+	if _, err := parseIsolation("linearizable"); err == nil {
+		t.Fatal("expected an error for an unsupported level")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int{
+		"1024": 1024,
+		"64KB": 64 << 10,
+		"64k":  64 << 10,
+		"1 MB": 1 << 20,
+	} {
+		n, err := parseSize(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+		} else if n != want {
+			t.Errorf("%q: expected %d, got %d", s, want, n)
+		}
+	}
+	if _, err := parseSize("lots"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestFormatDSNEncryption(t *testing.T) {
+	cfg := &Config{
+		Params: []Param{{"uid", "dba"}},
+		Encryption: &Encryption{
+			Type:                EncryptionTLS,
+			TrustedCertificates: `c:\certs\rsaroot.crt`,
+			CertificateName:     "db.example.com",
+		},
+	}
+	dsn := cfg.FormatDSN()
+	want := `uid=dba;enc=tls(tls_type=rsa;trusted_certificates=c:\certs\rsaroot.crt;certificate_name=db.example.com)`
+	if dsn != want {
+		t.Fatalf("expected %q, got %q", want, dsn)
+	}
+	cfg2, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Encryption.TLSType = "rsa"
+	if !reflect.DeepEqual(cfg, cfg2) {
+		t.Fatalf("%q does not round-trip: %+v != %+v", dsn, cfg.Encryption, cfg2.Encryption)
+	}
+
+	enc := &Encryption{Type: EncryptionSimple, CertificateName: "x"}
+	if err = enc.validate(); err == nil {
+		t.Fatal("expected TLS parameters to be rejected for simple encryption")
+	}
+}
+
+func TestValidateDateOptions(t *testing.T) {
+	for _, c := range []struct {
+		format, order string
+		valid         bool
+	}{
+		{"", "", true},
+		{"YYYY-MM-DD", "MDY", true},
+		{"dd/mm/yy", "dmy", true},
+		{"YYYY-JJJ-MMM", "", true},
+		{"YYYY-MM", "", false},
+		{"YYYY-MM-DD HH", "", false},
+		{"", "DYM", false},
+	} {
+		cfg := &Config{DateFormat: c.format, DateOrder: c.order}
+		if err := cfg.validateDateOptions(); (err == nil) != c.valid {
+			t.Errorf("%q, %q: unexpected validation result %v", c.format, c.order, err)
+		}
+	}
+}
+
+func TestValidateTimestampFormat(t *testing.T) {
+	for layout, valid := range map[string]bool{
+		"":                        true,
+		"2006-01-02T15:04:05.000": true,
+		"2006/01/02 03:04:05 PM":  true,
+		"2006-01-02":              false,
+		"not a layout":            false,
+	} {
+		cfg := &Config{TimestampFormat: layout}
+		if err := cfg.validateTimestampFormat(); (err == nil) != valid {
+			t.Errorf("%q: unexpected validation result %v", layout, err)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// value conversions
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var converters struct {
+	sync.RWMutex
+	byType map[nativeType]func([]byte) (driver.Value, error)
+}
+
+// RegisterConverter registers fn to convert the values of columns of the
+// native type typeCode (one of the DT_* constants) instead of the default
+// conversion, e.g. to decode a site-specific encoding.
+// fn receives the raw value - the bytes of strings and binary values as
+// sent by the server, the machine representation of numbers otherwise.
+// The slice is only valid for the duration of the call.
+// NULLs are not passed to fn. A nil fn removes the converter.
+func RegisterConverter(typeCode int, fn func([]byte) (driver.Value, error)) {
+	converters.Lock()
+	defer converters.Unlock()
+	if fn == nil {
+		delete(converters.byType, nativeType(typeCode))
+		return
+	}
+	if converters.byType == nil {
+		converters.byType = make(map[nativeType]func([]byte) (driver.Value, error))
+	}
+	converters.byType[nativeType(typeCode)] = fn
+}
+
+func converter(typ nativeType) func([]byte) (driver.Value, error) {
+	converters.RLock()
+	defer converters.RUnlock()
+	return converters.byType[typ]
+}
+
+// Assigns v to the variable dest points to (the destination of an
+// output parameter) - a simplified version of what database/sql does
+// when scanning
+func assignOut(dest interface{}, v driver.Value) error {
+	if sc, ok := dest.(sql.Scanner); ok {
+		return sc.Scan(v)
+	}
+	d := reflect.ValueOf(dest).Elem()
+	if v == nil {
+		d.Set(reflect.Zero(d.Type()))
+		return nil
+	}
+	sv := reflect.ValueOf(v)
+	switch {
+	case sv.Type().AssignableTo(d.Type()):
+		d.Set(sv)
+		return nil
+	case isByteArray(d.Type()):
+		return assignByteArray(d, v)
+	case d.Kind() == reflect.String:
+		if b, ok := v.([]byte); ok {
+			d.SetString(string(b))
+		} else {
+			d.SetString(fmt.Sprint(v))
+		}
+		return nil
+	case d.Kind() == reflect.Slice && d.Type().Elem().Kind() == reflect.Uint8 &&
+		sv.Kind() == reflect.String:
+		d.SetBytes([]byte(sv.String()))
+		return nil
+	case isNumeric(sv.Kind()) && isNumeric(d.Kind()):
+		d.Set(sv.Convert(d.Type()))
+		return nil
+	}
+	return fmt.Errorf("sqla: cannot assign %T to %s", v, d.Type())
+}
+
+// ByteArray returns a sql.Scanner which copies a binary value into the
+// fixed-size byte array dest points to (such as a *[16]byte holding a
+// UUID) as database/sql only scans into slices, e.g.
+//
+//	var id [16]byte
+//	err := db.QueryRow("select id from t").Scan(sqlany.ByteArray(&id))
+//
+// The value has to be of the length of the array. NULL zeroes the array.
+func ByteArray(dest interface{}) sql.Scanner {
+	return byteArray{dest: dest}
+}
+
+type byteArray struct {
+	dest interface{}
+}
+
+func (a byteArray) Scan(src interface{}) error {
+	d := reflect.ValueOf(a.dest)
+	if d.Kind() != reflect.Ptr || d.IsNil() || !isByteArray(d.Type().Elem()) {
+		return fmt.Errorf("sqla: ByteArray destination must be a pointer to a byte array, got %T", a.dest)
+	}
+	d = d.Elem()
+	if src == nil {
+		d.Set(reflect.Zero(d.Type()))
+		return nil
+	}
+	return assignByteArray(d, src)
+}
+
+func isByteArray(t reflect.Type) bool {
+	return t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8
+}
+
+// Copies a binary (or string) value into the byte array d
+func assignByteArray(d reflect.Value, v driver.Value) error {
+	var b []byte
+	switch v := v.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("sqla: cannot assign %T to %s", v, d.Type())
+	}
+	if len(b) != d.Len() {
+		return fmt.Errorf("sqla: cannot assign %d bytes to %s", len(b), d.Type())
+	}
+	reflect.Copy(d, reflect.ValueOf(b))
+	return nil
+}
+
+func isNumeric(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// layouts of the textual temporal values in the default server formats
+// (the fractional seconds are optional when parsing)
+var temporalLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"15:04:05",
+}
+
+// layout TIME values are bound with
+const timeOfDayLayout = "15:04:05.000000"
+
+// TimeOfDay is a time of day (the time elapsed since midnight) which is
+// bound as a TIME value, e.g.
+//
+//	db.Exec("insert into shifts (starts) values (?)", sqlany.TimeOfDay(9*time.Hour+30*time.Minute))
+//
+// TIME columns can also be scanned into a TimeOfDay.
+type TimeOfDay time.Duration
+
+// Value implements driver.Valuer
+func (t TimeOfDay) Value() (driver.Value, error) {
+	d := time.Duration(t)
+	if d < 0 || d >= 24*time.Hour {
+		return nil, fmt.Errorf("sqla: time of day out of range: %v", d)
+	}
+	return timeOfDay(time.Time{}.Add(d)), nil
+}
+
+// Scan implements sql.Scanner for TIME values (time.Time on 0000-01-01)
+func (t *TimeOfDay) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		h, m, s := v.Clock()
+		*t = TimeOfDay(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+			time.Duration(s)*time.Second + time.Duration(v.Nanosecond()))
+		return nil
+	case string:
+		tm, err := time.Parse("15:04:05", v)
+		if err != nil {
+			return fmt.Errorf("sqla: invalid time of day %q", v)
+		}
+		return t.Scan(tm)
+	}
+	return fmt.Errorf("sqla: cannot scan %T into TimeOfDay", src)
+}
+
+// formats the time of day of t
+func timeOfDay(t time.Time) string {
+	return t.Format(timeOfDayLayout)
+}
+
+// TypedValue is a parameter value in the native representation of a
+// data type which is bound as is, without the conversions (and the
+// reflection) applied to other values, for hot paths binding values of
+// known types over and over, e.g.
+//
+//	binary.LittleEndian.PutUint64(buf, uint64(id))
+//	db.Exec("delete from t where id = ?", sqlany.TypedValue{Datatype: int(sqlany.A_VAL64), Buffer: buf})
+//
+// Datatype is one of the A_* constants. Buffer holds the value in the
+// machine representation for numbers (8 bytes for A_VAL64, little-endian)
+// and the bytes of A_STRING (UTF-8) and A_BINARY values. A nil Buffer
+// binds NULL.
+type TypedValue struct {
+	Datatype int
+	Buffer   []byte
+}
+
+// Converts a json.Number (as decoded with json.Decoder.UseNumber) into
+// the value it is bound as: integers as int64, other numbers (fractions,
+// exponents, integers out of the int64 range) as their text which the
+// server converts to the type of the target exactly.
+func jsonNumber(n json.Number) (driver.Value, error) {
+	if i, err := n.Int64(); err == nil {
+		return i, nil
+	}
+	if _, err := n.Float64(); err != nil && !errors.Is(err, strconv.ErrRange) {
+		return nil, fmt.Errorf("sqla: invalid number %q", string(n))
+	}
+	return string(n), nil
+}
+
+// Converts the text of a DECIMAL value to the nearest float64 or, if
+// truncate is set, to the nearest float64 toward zero
+func decimalFloat(s string, truncate bool) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("sqla: invalid decimal %q", s)
+	}
+	if !truncate || f == 0 {
+		return f, nil
+	}
+	exact, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("sqla: invalid decimal %q", s)
+	}
+	// rounded away from zero if the magnitude has grown
+	if new(big.Rat).SetFloat64(math.Abs(f)).Cmp(exact.Abs(exact)) > 0 {
+		f = math.Nextafter(f, 0)
+	}
+	return f, nil
+}
+
+func isTemporal(typ nativeType) bool {
+	switch typ {
+	case DT_DATE, DT_TIME, DT_TIMESTAMP:
+		return true
+	}
+	return false
+}
+
+// Converts the text of a DATE, TIME or TIMESTAMP value (as sent by the
+// server) into a time.Time in loc. TIME values are on 0000-01-01.
+// Values not in the default format (as configured with the
+// TIMESTAMP_FORMAT/DATE_FORMAT/TIME_FORMAT server options) are
+// returned as is.
+func parseTemporal(v driver.Value, loc *time.Location) driver.Value {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	for _, layout := range temporalLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t
+		}
+	}
+	return v
+}
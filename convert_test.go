@@ -0,0 +1,134 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAssignOut(t *testing.T) {
+	var i int
+	if err := assignOut(&i, int32(42)); err != nil || i != 42 {
+		t.Fatalf("expected 42, got %d (%v)", i, err)
+	}
+	var s string
+	if err := assignOut(&s, []byte("done")); err != nil || s != "done" {
+		t.Fatalf("expected done, got %q (%v)", s, err)
+	}
+	var ns sql.NullString
+	if err := assignOut(&ns, nil); err != nil || ns.Valid {
+		t.Fatalf("expected NULL, got %v (%v)", ns, err)
+	}
+	var f float64
+	if err := assignOut(&f, "x"); err == nil {
+		t.Fatal("expected an error")
+	}
+	var a [4]byte
+	if err := assignOut(&a, []byte{1, 2, 3, 4}); err != nil || a != [4]byte{1, 2, 3, 4} {
+		t.Fatalf("expected [1 2 3 4], got %v (%v)", a, err)
+	}
+}
+
+func TestByteArray(t *testing.T) {
+	var id [16]byte
+	src := []byte("0123456789abcdef")
+	if err := ByteArray(&id).Scan(src); err != nil || string(id[:]) != string(src) {
+		t.Fatalf("expected %q, got %q (%v)", src, id, err)
+	}
+	if err := ByteArray(&id).Scan(src[:8]); err == nil {
+		t.Fatal("expected an error for a value of a different length")
+	}
+	if err := ByteArray(&id).Scan(nil); err != nil || id != [16]byte{} {
+		t.Fatalf("expected NULL to zero the array, got %v (%v)", id, err)
+	}
+	if err := ByteArray(&src).Scan(src); err == nil {
+		t.Fatal("expected an error for a slice destination")
+	}
+}
+
+func TestTimeOfDay(t *testing.T) {
+	tod := TimeOfDay(9*time.Hour + 30*time.Minute + 15*time.Second + 250*time.Millisecond)
+	v, err := tod.Value()
+	if err != nil || v != "09:30:15.250000" {
+		t.Fatalf("expected 09:30:15.250000, got %v (%v)", v, err)
+	}
+	if _, err = TimeOfDay(25 * time.Hour).Value(); err == nil {
+		t.Fatal("expected an error for a time of day out of range")
+	}
+	var scanned TimeOfDay
+	if err = scanned.Scan(time.Date(0, 1, 1, 9, 30, 15, 250e6, time.UTC)); err != nil || scanned != tod {
+		t.Fatalf("expected %v, got %v (%v)", time.Duration(tod), time.Duration(scanned), err)
+	}
+}
+
+func TestJSONNumber(t *testing.T) {
+	for _, tc := range []struct {
+		n    json.Number
+		want driver.Value
+	}{
+		{"12345", int64(12345)},
+		{"-7", int64(-7)},
+		{"123.45", "123.45"},
+		{"1e3", "1e3"},
+		{"18446744073709551616", "18446744073709551616"},
+	} {
+		v, err := jsonNumber(tc.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != tc.want {
+			t.Errorf("%s: expected %#v, got %#v", tc.n, tc.want, v)
+		}
+	}
+	if _, err := jsonNumber("12abc"); err == nil {
+		t.Error("expected an error for an invalid number")
+	}
+}
+
+func TestDecimalFloat(t *testing.T) {
+	// more significant digits than float64 holds - the nearest float64
+	// is above the exact value
+	const s = "12345678901234567.89"
+	for _, tc := range []struct {
+		s        string
+		truncate bool
+		want     float64
+	}{
+		{s, false, 12345678901234568},
+		{s, true, 12345678901234566},
+		{"-" + s, true, -12345678901234566},
+		{"1234.50", true, 1234.5},
+		{"0.00", true, 0},
+	} {
+		f, err := decimalFloat(tc.s, tc.truncate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f != tc.want {
+			t.Errorf("%s (truncate=%t): expected %f, got %f", tc.s, tc.truncate, tc.want, f)
+		}
+	}
+	if _, err := decimalFloat("1.2.3", false); err == nil {
+		t.Error("expected an error for an invalid decimal")
+	}
+}
+
+func TestRegisterConverter(t *testing.T) {
+	fn := func(b []byte) (driver.Value, error) { return len(b), nil }
+	RegisterConverter(DT_BIT, fn)
+	conv := converter(DT_BIT)
+	if conv == nil {
+		t.Fatal("expected a converter")
+	}
+	if v, _ := conv([]byte{1}); v != 1 {
+		t.Fatalf("expected the registered converter, got %v", v)
+	}
+	RegisterConverter(DT_BIT, nil)
+	if converter(DT_BIT) != nil {
+		t.Fatal("expected the converter to be removed")
+	}
+}
@@ -12,7 +12,8 @@ import (
 
 const (
 	API_VERSION_1     = 1
-	API_VERSION_2     = 2
+	API_VERSION_2     = 2 // sqlany_cancel
+	API_VERSION_5     = 5 // A_FLOAT
 	SACAPI_ERROR_SIZE = 256
 
 	libdbcapi_dll = "dbcapi.dll"
@@ -34,6 +35,7 @@ const (
 	A_UVAL16
 	A_VAL8 // bytes
 	A_UVAL8
+	A_FLOAT // 32bit floating point
 )
 
 type nativeType int32
@@ -60,6 +62,9 @@ const (
 	DT_UNSSMALLINT  = 616
 	DT_UNSBIGINT    = 620
 	DT_BIT          = 624
+	DT_NSTRING      = 628
+	DT_NFIXCHAR     = 632
+	DT_NVARCHAR     = 636
 	DT_LONGNVARCHAR = 640
 )
 
@@ -71,7 +76,7 @@ type dataValue struct {
 	buffersize uintptr
 	length     *uintptr
 	datatype   dataType
-	isnull     *bool
+	isnull     *sacapi_bool
 }
 
 // converts specified byte pointer to a proper slice object
@@ -92,50 +97,114 @@ func byteSlice(b *byte, size int) []byte {
 }
 
 func (dv *dataValue) String() string {
-	isnull := bool(*dv.isnull)
+	isnull := *dv.isnull != 0
 	s := fmt.Sprintf("type: %d, null: %t, length: %d, buffer size: %d, value: %s",
 		dv.datatype, isnull, *dv.length, dv.buffersize,
 		bytePtrToString(dv.buffer))
 	return s
 }
 
-func (dv *dataValue) bufferValue() []byte {
+// copies the value out of the native buffer into buf which is reused
+// if large enough (or nil to always allocate)
+func (dv *dataValue) bufferValue(buf []byte) []byte {
 	size := int(*dv.length)
+	if size == 0 {
+		if buf == nil {
+			return []byte{}
+		}
+		return buf[:0]
+	}
 	// [ap]: optimize by using a single cast for buffers upto 1mb in size
 	// fall back to slower method if bigger
 	if size < 1<<20 {
-		b := make([]byte, int(*dv.length))
+		if cap(buf) < size {
+			buf = make([]byte, size)
+		}
+		b := buf[:size]
 		copy(b, (*[1 << 20]byte)(unsafe.Pointer(dv.buffer))[:])
 		return b
 	}
 	return byteSlice(dv.buffer, size)
 }
 
+// copies the raw bytes of the value through buf (see bufferValue)
+func (dv *dataValue) raw(buf *[]byte) []byte {
+	switch dv.datatype {
+	case A_BINARY, A_STRING:
+		*buf = dv.bufferValue(*buf)
+		return *buf
+	}
+	size := dv.datatype.fixedSize()
+	if cap(*buf) < size {
+		*buf = make([]byte, size)
+	}
+	b := (*buf)[:size]
+	copy(b, (*[8]byte)(unsafe.Pointer(dv.buffer))[:size])
+	return b
+}
+
+// size of the values of fixed-size data types, 0 for A_BINARY and
+// A_STRING
+func (dt dataType) fixedSize() int {
+	switch dt {
+	case A_DOUBLE, A_VAL64, A_UVAL64:
+		return 8
+	case A_VAL32, A_UVAL32, A_FLOAT:
+		return 4
+	case A_VAL16, A_UVAL16:
+		return 2
+	case A_VAL8, A_UVAL8:
+		return 1
+	}
+	return 0
+}
+
 func (dv *dataValue) isNull() bool {
-	return bool(*dv.isnull)
+	return *dv.isnull != 0
 }
 
 // reference to resultset/statement/just character set?
 func (dv *dataValue) Value() (v interface{}) {
+	return dv.value(nil)
+}
+
+// Same as Value but copies string and binary data through buf (see
+// bufferValue) which is updated to the possibly grown buffer.
+// Binary values returned alias the buffer.
+func (dv *dataValue) value(buf *[]byte) (v interface{}) {
 	if dv.isNull() {
 		// null
 		v = nil
 		return
 	}
 	switch dv.datatype {
-	case A_BINARY:
-		v = dv.bufferValue()
-	case A_STRING:
+	case A_BINARY, A_STRING:
+		var b []byte
+		if buf != nil {
+			b = dv.bufferValue(*buf)
+			*buf = b
+		} else {
+			b = dv.bufferValue(nil)
+		}
+		if dv.datatype == A_BINARY {
+			v = b
+			break
+		}
+		// DECIMAL/NUMERIC values are reported as A_STRING as well and
+		// keep their exact textual form
+		//
 		// currently, character set is configured as utf-8 (effective
 		// for each connection, set as a connection option)
 		// this will make the server provide text in unicode w/o having
 		// to perform manual conversion
-		v = byteSliceToString(dv.bufferValue())
+		v = byteSliceToString(b)
 	case A_DOUBLE:
 		v = *(*float64)(unsafe.Pointer(dv.buffer))
 	case A_VAL64:
 		v = *(*int64)(unsafe.Pointer(dv.buffer))
 	case A_UVAL64:
+		// unsigned types are decoded as such so that values at the top
+		// of their range (beyond the signed range) read correctly
 		v = *(*uint64)(unsafe.Pointer(dv.buffer))
 	case A_VAL32:
 		v = *(*int32)(unsafe.Pointer(dv.buffer))
@@ -149,6 +218,8 @@ func (dv *dataValue) Value() (v interface{}) {
 		v = *(*int8)(unsafe.Pointer(dv.buffer))
 	case A_UVAL8:
 		v = *dv.buffer
+	case A_FLOAT:
+		v = *(*float32)(unsafe.Pointer(dv.buffer))
 	}
 	return
 }
@@ -268,11 +339,34 @@ var (
 // Might refactor later to avoid the allocation by directly using
 // scyscall.Syscall/syscall.Syscall6 instead.
 
-func sqlaInit(name string) bool {
-	ret, _, _ := sqlany_init.Call(uintptr(unsafe.Pointer(syscall.StringBytePtr(name))),
-		uintptr(API_VERSION_1),
-		0)
-	return ret != 1
+// Initializes the interface with the highest API version the driver
+// knows of (API_VERSION_5) or, with an older client library, the highest
+// one the library supports and returns the version initialized - the
+// features of later versions are not available otherwise
+func sqlaInit(name string) (version int, ok bool) {
+	var max sacapi_u32
+	for version = API_VERSION_5; ; version = int(max) {
+		ret, _, _ := sqlany_init.Call(uintptr(unsafe.Pointer(syscall.StringBytePtr(name))),
+			uintptr(version),
+			uintptr(unsafe.Pointer(&max)))
+		if ret == 1 {
+			return version, true
+		}
+		if int(max) < API_VERSION_1 || int(max) >= version {
+			return 0, false
+		}
+	}
+}
+
+// version of the client library such as 17.0.10.6285
+func clientVersion() string {
+	var buf [64]byte
+	ret, _, _ := sqlany_client_version.Call(uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)))
+	if ret != 1 {
+		return ""
+	}
+	return byteSliceToString(buf[:])
 }
 
 func sqlaFini() {
@@ -301,6 +395,12 @@ func (conn sqlaConn) connect(opts string) (err error) {
 	return nil
 }
 
+// Cancels the operation currently executing on the connection.
+// Safe to call from a different goroutine.
+func (conn sqlaConn) cancel() {
+	sqlany_cancel.Call(uintptr(conn))
+}
+
 func (conn sqlaConn) disconnect() bool {
 	ret, _, _ := sqlany_disconnect.Call(uintptr(conn))
 	return ret == 1
@@ -360,22 +460,35 @@ func (stmt sqlaStmt) reset() bool {
 // returns number of columns in result set or -1 upon failure
 func (stmt sqlaStmt) numCols() int {
 	ret, _, _ := sqlany_num_cols.Call(uintptr(stmt))
-	return int(ret)
+	return int(sacapi_i32(ret))
 }
 
 // returns number of rows affected by execution of a previously prepared
 // statement
 // returns -1 upon failure
+//
+// The native function returns a sacapi_i32 - only the lower 32 bits of
+// the return register are meaningful, so the value has to be truncated
+// before widening or -1 turns into 4294967295 on 64bit.
+// Set-based statements (INSERT ... SELECT, MERGE) report the total number
+// of rows they touched through the same call.
 func (stmt sqlaStmt) affectedRows() int {
 	ret, _, _ := sqlany_affected_rows.Call(uintptr(stmt))
-	return int(ret)
+	return int(sacapi_i32(ret))
+}
+
+// returns the number of rows in the result set: negative if the number
+// is an estimate (its absolute value is the estimate)
+func (stmt sqlaStmt) numRows() int {
+	ret, _, _ := sqlany_num_rows.Call(uintptr(stmt))
+	return int(sacapi_i32(ret))
 }
 
 // returns number of parameters expected for a prepared statement
 // returns -1 if the statement is invalid
 func (stmt sqlaStmt) numParams() int {
 	ret, _, _ := sqlany_num_params.Call(uintptr(stmt))
-	return int(ret)
+	return int(sacapi_i32(ret))
 }
 
 func (stmt sqlaStmt) fetchNext() bool {
@@ -407,6 +520,17 @@ func (stmt sqlaStmt) bindParam(index sacapi_u32, bindparam *bindParam) bool {
 	return ret == 1
 }
 
+// Sends data for the bound parameter `index` - can be invoked repeatedly
+// to send a large value in chunks.
+// The parameter must have been bound without a buffer.
+func (stmt sqlaStmt) sendParamData(index sacapi_u32, buffer []byte) bool {
+	ret, _, _ := sqlany_send_param_data.Call(uintptr(stmt),
+		uintptr(index),
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(len(buffer)))
+	return ret == 1
+}
+
 func (conn sqlaConn) commit() bool {
 	ret, _, _ := sqlany_commit.Call(uintptr(conn))
 	return ret == 1
@@ -448,14 +572,15 @@ func (stmt sqlaStmt) getDataInfo(colindex sacapi_u32, datainfo *dataInfo) bool {
 	return ret == 1
 }
 
-func (stmt sqlaStmt) getData(colindex sacapi_u32, offset uintptr,
-	buffer *uintptr, size uintptr) bool {
+// Reads the value of the column starting at offset into buf.
+// Returns the number of bytes read or -1 on failure.
+func (stmt sqlaStmt) getData(colindex sacapi_u32, offset uintptr, buf []byte) int {
 	ret, _, _ := sqlany_get_data.Call(uintptr(stmt),
 		uintptr(colindex),
 		offset,
-		uintptr(unsafe.Pointer(buffer)),
-		size)
-	return ret == 1
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)))
+	return int(sacapi_i32(ret))
 }
 
 // Moves to the next result set in multiple result sets return
@@ -482,6 +607,24 @@ func (conn sqlaConn) queryError() (code sacapi_i32, err string) {
 	return
 }
 
+// code of the last error (or warning) w/o copying the message
+func (conn sqlaConn) errorCode() sacapi_i32 {
+	var buf [1]byte
+	ret, _, _ := sqlany_error.Call(uintptr(conn),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)))
+	return sacapi_i32(ret)
+}
+
+// SQLSTATE of the last error (or warning), 00000 if there's none
+func (conn sqlaConn) sqlState() string {
+	var buf [6]byte // 5 characters and the null terminator
+	sqlany_sqlstate.Call(uintptr(conn),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)))
+	return byteSliceToString(buf[:])
+}
+
 func byteSliceToString(b []byte) string {
 	for i, v := range b {
 		if v == 0 {
@@ -500,6 +643,8 @@ func bytePtrToString(b *byte) string {
 type sqlaError struct {
 	code sacapi_i32
 	msg  string
+	// position of a syntax error in the statement (see locate)
+	line, column, offset int
 }
 
 func (err *sqlaError) Error() string {
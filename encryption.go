@@ -0,0 +1,156 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// connection encryption
+
+import (
+	"fmt"
+	"strings"
+)
+
+// encryption types
+const (
+	EncryptionNone   = "none"
+	EncryptionSimple = "simple"
+	EncryptionTLS    = "tls"
+)
+
+// Encryption configures the encryption of the connection - the
+// `Encryption` (`ENC`) connection parameter, e.g.
+//
+//	ENC=tls(tls_type=rsa;trusted_certificates=rsaroot.crt)
+type Encryption struct {
+	Type string // EncryptionNone, EncryptionSimple or EncryptionTLS
+
+	// the remaining fields only apply to TLS
+
+	// TLS cipher (rsa if empty)
+	TLSType string
+	// file with the certificates of the trusted certificate authorities
+	TrustedCertificates string
+	// expected common name, organization and organizational unit of the
+	// server certificate
+	CertificateName    string
+	CertificateCompany string
+	CertificateUnit    string
+	// do not verify the server certificate name against the host name
+	SkipCertificateNameCheck bool
+	// use FIPS-approved algorithms
+	FIPS bool
+}
+
+// names of the TLS parameters
+const (
+	tlsType                 = "tls_type"
+	tlsTrustedCertificates  = "trusted_certificates"
+	tlsCertificateName      = "certificate_name"
+	tlsCertificateCompany   = "certificate_company"
+	tlsCertificateUnit      = "certificate_unit"
+	tlsSkipCertificateCheck = "skip_certificate_name_check"
+	tlsFIPS                 = "fips"
+)
+
+// parses the value of the ENC connection parameter
+func parseEncryption(v string) (*Encryption, error) {
+	enc := &Encryption{Type: strings.ToLower(strings.TrimSpace(v))}
+	if i := strings.IndexByte(v, '('); i >= 0 {
+		if !strings.HasSuffix(v, ")") {
+			return nil, fmt.Errorf("unbalanced parentheses in %q", v)
+		}
+		enc.Type = strings.ToLower(strings.TrimSpace(v[:i]))
+		for _, attr := range splitDSN(v[i+1 : len(v)-1]) {
+			attr = strings.TrimSpace(attr)
+			if attr == "" {
+				continue
+			}
+			j := strings.IndexByte(attr, '=')
+			if j < 0 {
+				return nil, fmt.Errorf("invalid encryption parameter %q", attr)
+			}
+			name := strings.ToLower(strings.TrimSpace(attr[:j]))
+			value := unquoteValue(strings.TrimSpace(attr[j+1:]))
+			var err error
+			switch name {
+			case tlsType:
+				enc.TLSType = value
+			case tlsTrustedCertificates:
+				enc.TrustedCertificates = value
+			case tlsCertificateName:
+				enc.CertificateName = value
+			case tlsCertificateCompany:
+				enc.CertificateCompany = value
+			case tlsCertificateUnit:
+				enc.CertificateUnit = value
+			case tlsSkipCertificateCheck:
+				enc.SkipCertificateNameCheck, err = parseBool(value)
+			case tlsFIPS:
+				enc.FIPS, err = parseBool(value)
+			default:
+				return nil, fmt.Errorf("unknown encryption parameter %q", name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %v", name, err)
+			}
+		}
+	}
+	if err := enc.validate(); err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+func (enc *Encryption) validate() error {
+	switch enc.Type {
+	case EncryptionNone, EncryptionSimple:
+		if enc.hasTLSParams() {
+			return fmt.Errorf("TLS parameters given for %s encryption", enc.Type)
+		}
+	case EncryptionTLS:
+		for _, v := range []string{enc.TLSType, enc.TrustedCertificates,
+			enc.CertificateName, enc.CertificateCompany, enc.CertificateUnit} {
+			// can't be escaped within the parentheses
+			if strings.ContainsAny(v, ";()") {
+				return fmt.Errorf("invalid TLS parameter value %q", v)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown encryption type %q", enc.Type)
+	}
+	return nil
+}
+
+func (enc *Encryption) hasTLSParams() bool {
+	return enc.TLSType != "" || enc.TrustedCertificates != "" || enc.CertificateName != "" ||
+		enc.CertificateCompany != "" || enc.CertificateUnit != "" ||
+		enc.SkipCertificateNameCheck || enc.FIPS
+}
+
+// String formats the value of the ENC connection parameter
+func (enc *Encryption) String() string {
+	if enc.Type != EncryptionTLS {
+		return enc.Type
+	}
+	tlstype := enc.TLSType
+	if tlstype == "" {
+		tlstype = "rsa"
+	}
+	params := []string{tlsType + "=" + tlstype}
+	for _, p := range []Param{
+		{tlsTrustedCertificates, enc.TrustedCertificates},
+		{tlsCertificateName, enc.CertificateName},
+		{tlsCertificateCompany, enc.CertificateCompany},
+		{tlsCertificateUnit, enc.CertificateUnit},
+	} {
+		if p.Value != "" {
+			params = append(params, p.Name+"="+p.Value)
+		}
+	}
+	if enc.SkipCertificateNameCheck {
+		params = append(params, tlsSkipCertificateCheck+"=yes")
+	}
+	if enc.FIPS {
+		params = append(params, tlsFIPS+"=yes")
+	}
+	return EncryptionTLS + "(" + strings.Join(params, ";") + ")"
+}
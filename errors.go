@@ -0,0 +1,281 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// error classification
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrAuthFailed is matched (with errors.Is) by errors reported when the
+// server rejects the credentials - retrying such a connection is futile
+var ErrAuthFailed = errors.New("sqla: authentication failed")
+
+// ErrConnLost is matched (with errors.Is) by errors reported when the
+// connection to the server has been lost
+var ErrConnLost = errors.New("sqla: connection lost")
+
+// native SQLCODEs
+const (
+	sqlcodeNotFound             = 100
+	sqlcodeInvalidLogon         = -103 // invalid user ID or password
+	sqlcodeCommunicationError   = -85
+	sqlcodeNotConnected         = -101
+	sqlcodeConnectionTerminated = -308
+	sqlcodeConnectionError      = -832
+	sqlcodeInvalidStatement     = -130
+	sqlcodeSyntaxError          = -131
+	sqlcodePrimaryKeyNotUnique  = -193
+	sqlcodeNoPrimaryKeyValue    = -194
+	sqlcodeColumnNotNull        = -195
+	sqlcodeIndexNotUnique       = -196
+	sqlcodePrimaryKeyReferenced = -198
+	sqlcodeCheckViolated        = -209
+	sqlcodeRowLocked            = -210
+	sqlcodeInterrupted          = -299
+	sqlcodeFetchNextOnly        = -668
+	sqlcodeDeadlock             = -306
+	sqlcodeThreadsBlocked       = -307
+)
+
+// ErrorCategory is the portable class of an error (see Classify)
+type ErrorCategory int
+
+// error categories
+const (
+	// not an error of the server or not classified
+	Unknown ErrorCategory = iota
+	// the operation may succeed if retried (deadlocks, lock conflicts)
+	Transient
+	// a constraint has been violated (unique and foreign keys, NOT NULL
+	// and check constraints)
+	Constraint
+	// the statement is malformed
+	Syntax
+	// the server rejected the credentials
+	AuthFailure
+	// the connection to the server has been lost
+	ConnectionLost
+	// the statement has been interrupted (such as by a canceled
+	// context)
+	Timeout
+)
+
+var categoryNames = [...]string{"unknown", "transient", "constraint", "syntax",
+	"auth failure", "connection lost", "timeout"}
+
+func (c ErrorCategory) String() string {
+	if c < 0 || int(c) >= len(categoryNames) {
+		return fmt.Sprintf("ErrorCategory(%d)", int(c))
+	}
+	return categoryNames[c]
+}
+
+// Classify maps the native code of an error reported by the server to
+// its category so that retry logic can be written without knowing
+// SQLCODEs, e.g.
+//
+//	if sqlany.Classify(err) == sqlany.Transient {
+//		// retry the transaction
+//	}
+//
+// Wrapped errors are unwrapped. Errors which do not originate from the
+// server are Unknown.
+func Classify(err error) ErrorCategory {
+	var e *sqlaError
+	if !errors.As(err, &e) {
+		return Unknown
+	}
+	switch e.code {
+	case sqlcodeRowLocked, sqlcodeDeadlock, sqlcodeThreadsBlocked:
+		return Transient
+	case sqlcodePrimaryKeyNotUnique, sqlcodeNoPrimaryKeyValue, sqlcodeColumnNotNull,
+		sqlcodeIndexNotUnique, sqlcodePrimaryKeyReferenced, sqlcodeCheckViolated:
+		return Constraint
+	case sqlcodeInvalidStatement, sqlcodeSyntaxError:
+		return Syntax
+	case sqlcodeInvalidLogon:
+		// not -98 (authentication violation) which is about the
+		// license of an authenticated application, not the credentials
+		return AuthFailure
+	case sqlcodeCommunicationError, sqlcodeNotConnected, sqlcodeConnectionTerminated, sqlcodeConnectionError:
+		return ConnectionLost
+	case sqlcodeInterrupted:
+		return Timeout
+	}
+	return Unknown
+}
+
+// Is reports whether the error belongs to the class of errors denoted
+// by target (one of the Err* sentinels)
+func (err *sqlaError) Is(target error) bool {
+	switch target {
+	case ErrAuthFailed:
+		return Classify(err) == AuthFailure
+	case ErrConnLost:
+		return Classify(err) == ConnectionLost
+	}
+	return false
+}
+
+// ErrorPosition is implemented by the errors returned by the driver.
+// For a statement which failed to prepare because of a syntax error it
+// reports where the error is in the statement so that it can be
+// highlighted in the source, e.g.
+//
+//	var pos sqlany.ErrorPosition
+//	if errors.As(err, &pos) && pos.Line() > 0 {
+//		...
+//	}
+//
+// All positions are 1-based and zero if unknown.
+type ErrorPosition interface {
+	// Line of the statement the error has been reported on
+	Line() int
+	// Column (in characters) of the token the error has been reported
+	// near
+	Column() int
+	// Offset (in bytes) of the token in the statement
+	Offset() int
+}
+
+// Line of the statement a syntax error has been reported on
+func (err *sqlaError) Line() int {
+	return err.line
+}
+
+// Column of the token a syntax error has been reported near
+func (err *sqlaError) Column() int {
+	return err.column
+}
+
+// Offset of the token a syntax error has been reported near
+func (err *sqlaError) Offset() int {
+	return err.offset
+}
+
+// as in "Syntax error near 'FROM' on line 2"
+var syntaxErrorRe = regexp.MustCompile(`near '(.*)' on line (\d+)`)
+
+// Locates the syntax error reported for the query.
+// The server only reports the line and the token so the column is that
+// of the first occurrence of the token on the line.
+func (err *sqlaError) locate(query string) {
+	m := syntaxErrorRe.FindStringSubmatch(err.msg)
+	if m == nil {
+		return
+	}
+	line, _ := strconv.Atoi(m[2])
+	start := 0
+	for i := 1; i < line; i++ {
+		n := strings.IndexByte(query[start:], '\n')
+		if n < 0 {
+			return
+		}
+		start += n + 1
+	}
+	err.line = line
+	text := query[start:]
+	if n := strings.IndexByte(text, '\n'); n >= 0 {
+		text = text[:n]
+	}
+	if i := strings.Index(text, m[1]); i >= 0 && m[1] != "" {
+		err.column = utf8.RuneCountInString(text[:i]) + 1
+		err.offset = start + i + 1
+	}
+}
+
+// Reports whether err means that the connection has been lost in which
+// case the connection is marked as unusable (see ResetSession)
+func (cn *conn) lost(err error) bool {
+	if errors.Is(err, ErrConnLost) {
+		cn.connected = false
+		return true
+	}
+	return false
+}
+
+// ScriptError reports the statement of a script which failed (see
+// ExecScript)
+type ScriptError struct {
+	Index     int // of the statement in the script, 0-based
+	Statement string
+	Err       error
+}
+
+func (err *ScriptError) Error() string {
+	return fmt.Sprintf("sqla: statement %d of the script failed: %v", err.Index+1, err.Err)
+}
+
+// Unwrap returns the error of the statement
+func (err *ScriptError) Unwrap() error {
+	return err.Err
+}
+
+// BatchError lists the rows of a batch which failed validation (see
+// ExecBatch) - none of the rows have been sent to the server
+type BatchError struct {
+	Rows []RowError
+}
+
+// RowError reports an invalid row of a batch
+type RowError struct {
+	Index int // of the row in the batch, 0-based
+	Err   error
+}
+
+func (err *BatchError) Error() string {
+	msgs := make([]string, len(err.Rows))
+	for i, row := range err.Rows {
+		msgs[i] = fmt.Sprintf("row %d: %v", row.Index+1, row.Err)
+	}
+	return fmt.Sprintf("sqla: %d invalid rows in the batch: %s", len(err.Rows), strings.Join(msgs, "; "))
+}
+
+// Warning is a condition reported by the server for a statement which
+// nevertheless succeeded (such as NULLs eliminated in an aggregate or
+// a value truncated)
+type Warning struct {
+	Code    int // positive SQLCODE
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s (%d)", w.Message, w.Code)
+}
+
+// LastSQLCode returns the SQLCODE and SQLSTATE of the last operation on
+// the connection - also after a successful one so that warnings (which
+// have a positive SQLCODE) can be detected. The code is 0 (and the
+// state 00000) if the operation succeeded without a warning.
+// The values are connection-scoped: any use of the connection (such as
+// fetching a row) replaces them.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) LastSQLCode() (code int, state string) {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	return int(cn.cn.errorCode()), cn.cn.sqlState()
+}
+
+// Appends the warning of the last operation on the connection (if any)
+func (cn *conn) appendWarning(warnings []Warning) []Warning {
+	code := cn.cn.errorCode()
+	if code <= 0 || code == sqlcodeNotFound {
+		return warnings
+	}
+	_, msg := cn.cn.queryError()
+	w := Warning{Code: int(code), Message: msg}
+	for _, seen := range warnings {
+		if seen == w {
+			return warnings
+		}
+	}
+	return append(warnings, w)
+}
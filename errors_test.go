@@ -0,0 +1,39 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	for code, want := range map[sacapi_i32]ErrorCategory{
+		sqlcodeDeadlock:            Transient,
+		sqlcodeRowLocked:           Transient,
+		sqlcodePrimaryKeyNotUnique: Constraint,
+		sqlcodeColumnNotNull:       Constraint,
+		sqlcodeSyntaxError:         Syntax,
+		sqlcodeInvalidLogon:        AuthFailure,
+		sqlcodeConnectionError:     ConnectionLost,
+		sqlcodeInterrupted:         Timeout,
+		-141:                       Unknown, // table not found
+		-98:                        Unknown, // authenticated application licensing
+	} {
+		err := &sqlaError{code: code, msg: "test"}
+		if got := Classify(err); got != want {
+			t.Errorf("expected %v for %d, got %v", want, code, got)
+		}
+	}
+	wrapped := &ScriptError{Err: &sqlaError{code: sqlcodeDeadlock}}
+	if got := Classify(wrapped); got != Transient {
+		t.Errorf("expected the wrapped error to be transient, got %v", got)
+	}
+	if got := Classify(fmt.Errorf("failed: %w", errors.New("not a server error"))); got != Unknown {
+		t.Errorf("expected a non-driver error to be unknown, got %v", got)
+	}
+	if !errors.Is(&sqlaError{code: sqlcodeNotConnected}, ErrConnLost) {
+		t.Error("expected a lost connection to match ErrConnLost")
+	}
+}
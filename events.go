@@ -0,0 +1,240 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// server notifications
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Event is a notification delivered to subscribers
+type Event struct {
+	Name    string
+	Payload string
+}
+
+// Subscribe returns a channel receiving the events named name.
+//
+// Experimental: delivery is lossy and the API may change. The C API has
+// no callbacks for messages from the server so they are polled for
+// rather than delivered natively - messages arriving between two polls
+// are dropped.
+//
+// Events are messages of the form `name:payload` sent to the connection
+// listening on behalf of this one, e.g. from a trigger or a server event:
+//
+//	MESSAGE 'orders:42' FOR CONNECTION <id> IMMEDIATE
+//
+// where <id> is reported by EventListenerID. The listener is a separate
+// connection opened with the first subscription - it waits for messages
+// with WAITFOR ... AFTER MESSAGE BREAK in one second rounds and then
+// reads the message received.
+//
+// Delivery is lossy, the limits being:
+//   - each subscribing connection takes up a second connection on the
+//     server (counting against its connection limit)
+//   - the server only keeps the last message received so messages sent
+//     in quick succession (while the listener is reading the previous
+//     one) are lost
+//   - the listener notices that the connection has been closed only at
+//     the end of the current round, i.e. within a second
+//
+// Use a table polled by the application for notifications which must not
+// be lost.
+// Channels are buffered and events are dropped for subscribers which do
+// not keep up. They are closed when the connection is closed.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) Subscribe(name string) (<-chan Event, error) {
+	hub, err := cn.eventHub()
+	if err != nil {
+		return nil, err
+	}
+	return hub.subscribe(name), nil
+}
+
+// EventListenerID returns the connection number of the listener events
+// have to be sent to (see Subscribe)
+func (cn *conn) EventListenerID() (int, error) {
+	hub, err := cn.eventHub()
+	if err != nil {
+		return 0, err
+	}
+	return hub.src.id(), nil
+}
+
+func (cn *conn) eventHub() (*eventHub, error) {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	if cn.events == nil {
+		src, err := newEventSource(cn.cfg)
+		if err != nil {
+			return nil, err
+		}
+		cn.events = newEventHub(src)
+	}
+	return cn.events, nil
+}
+
+// a source of events
+type eventSource interface {
+	// blocks until the next event is available
+	next() (Event, error)
+	// connection number events are sent to
+	id() int
+	// unblocks next which then fails (safe to call concurrently)
+	interrupt()
+	// releases the source once next has returned
+	close() error
+}
+
+var errEventsClosed = errors.New("sqla: event listener closed")
+
+// overridden in tests
+var newEventSource = func(cfg *Config) (eventSource, error) {
+	return openMessageSource(cfg)
+}
+
+const eventBufferSize = 16
+
+type eventHub struct {
+	src  eventSource
+	done chan struct{}
+
+	mu   sync.Mutex
+	subs map[string][]chan Event
+}
+
+func newEventHub(src eventSource) *eventHub {
+	hub := &eventHub{
+		src:  src,
+		done: make(chan struct{}),
+		subs: make(map[string][]chan Event),
+	}
+	go hub.run()
+	return hub
+}
+
+func (hub *eventHub) subscribe(name string) <-chan Event {
+	ch := make(chan Event, eventBufferSize)
+	hub.mu.Lock()
+	hub.subs[name] = append(hub.subs[name], ch)
+	hub.mu.Unlock()
+	return ch
+}
+
+func (hub *eventHub) run() {
+	defer close(hub.done)
+	for {
+		ev, err := hub.src.next()
+		if err != nil {
+			return
+		}
+		hub.mu.Lock()
+		for _, ch := range hub.subs[ev.Name] {
+			select {
+			case ch <- ev:
+			default:
+				// subscriber not keeping up
+			}
+		}
+		hub.mu.Unlock()
+	}
+}
+
+// stops listening and closes all subscriber channels
+func (hub *eventHub) close() error {
+	hub.src.interrupt()
+	<-hub.done
+	err := hub.src.close()
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for name, subs := range hub.subs {
+		for _, ch := range subs {
+			close(ch)
+		}
+		delete(hub.subs, name)
+	}
+	return err
+}
+
+// events received as messages on a dedicated connection
+type messageSource struct {
+	cn     *conn
+	number int
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func openMessageSource(cfg *Config) (*messageSource, error) {
+	lcfg := *cfg
+	lcfg.SkipCharSetQuery = true
+	cn, err := open(context.Background(), &lcfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	var number string
+	if err = cn.queryRow("select connection_property('Number')", &number); err != nil {
+		cn.Close()
+		return nil, err
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		cn.Close()
+		return nil, err
+	}
+	return &messageSource{cn: cn, number: n}, nil
+}
+
+func (src *messageSource) next() (Event, error) {
+	for {
+		if src.isClosed() {
+			return Event{}, errEventsClosed
+		}
+		if err := src.cn.cn.executeImmediate("WAITFOR DELAY '00:00:01' AFTER MESSAGE BREAK"); err != nil {
+			if src.isClosed() {
+				return Event{}, errEventsClosed
+			}
+			return Event{}, err
+		}
+		var msg string
+		if err := src.cn.queryRow("select connection_property('MessageReceived')", &msg); err != nil {
+			return Event{}, err
+		}
+		if msg == "" {
+			continue // timed out
+		}
+		ev := Event{Name: msg}
+		if i := strings.IndexByte(msg, ':'); i >= 0 {
+			ev.Name, ev.Payload = msg[:i], msg[i+1:]
+		}
+		return ev, nil
+	}
+}
+
+func (src *messageSource) id() int {
+	return src.number
+}
+
+func (src *messageSource) isClosed() bool {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.closed
+}
+
+func (src *messageSource) interrupt() {
+	src.mu.Lock()
+	src.closed = true
+	src.mu.Unlock()
+	src.cn.cn.cancel()
+}
+
+func (src *messageSource) close() error {
+	return src.cn.Close()
+}
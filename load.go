@@ -0,0 +1,364 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// bulk loading and unloading
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// number of rows LoadTable inserts per transaction
+const loadBatchSize = 1000
+
+// LoadTable inserts the rows returned by next into the given columns of
+// table until next returns io.EOF, e.g.
+//
+//	i := 0
+//	n, err := cn.LoadTable(ctx, "items", []string{"id", "name"}, func() ([]interface{}, error) {
+//		if i == len(items) {
+//			return nil, io.EOF
+//		}
+//		i++
+//		return []interface{}{items[i-1].ID, items[i-1].Name}, nil
+//	})
+//
+// Table and column names are quoted - a table name with a dot is taken
+// as owner.table.
+// Outside of a transaction the rows are committed every 1000 rows and n
+// is the number of rows committed: if the load fails or ctx is done
+// (the running insert is canceled on the server) the rows inserted since
+// the last commit are rolled back and the connection is left without a
+// pending transaction.
+// Within a transaction (Begin) nothing is committed or rolled back - n is
+// the number of rows inserted and it is up to the caller to end the
+// transaction.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) LoadTable(ctx context.Context, table string, columns []string,
+	next func() ([]interface{}, error)) (n int64, err error) {
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+	names := make([]string, len(columns))
+	marks := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = QuoteIdentifier(c)
+		marks[i] = "?"
+	}
+	s, err := cn.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteQualified(table), strings.Join(names, ", "), strings.Join(marks, ", ")))
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+	st := s.(*stmt)
+	defer cn.watchCancel(ctx)()
+
+	// batches are committed by the load itself unless a transaction
+	// has been started by the caller
+	batched := cn.autocommit
+	// rows inserted since the last commit
+	var pending int64
+	var open bool
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var row []interface{}
+		if row, err = next(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			break
+		}
+		if len(row) != len(columns) {
+			err = fmt.Errorf("sqla: row %d has %d values, expected %d", n+pending+1, len(row), len(columns))
+			break
+		}
+		if batched && !open {
+			if err = cn.cn.executeImmediate("BEGIN TRAN"); err != nil {
+				break
+			}
+			open = true
+		}
+		vals := make([]driver.Value, len(row))
+		for i, v := range row {
+			vals[i] = v
+		}
+		if err = st.execute(vals); err != nil {
+			err = cn.ctxErr(ctx, err)
+			break
+		}
+		pending++
+		if batched && pending == loadBatchSize {
+			if !cn.cn.commit() {
+				err = cn.cn.newError()
+				break
+			}
+			n += pending
+			pending, open = 0, false
+		}
+	}
+	switch {
+	case !batched:
+		n += pending
+	case !open:
+	case err == nil && cn.cn.commit():
+		n += pending
+	default:
+		if err == nil {
+			err = cn.cn.newError()
+		}
+		_ = cn.cn.rollback() // the load error is reported
+	}
+	return n, err
+}
+
+// ExecBatch executes the statement once for each row of parameter
+// values, e.g.
+//
+//	n, err := cn.ExecBatch(ctx, "insert into items (id, name) values (?, ?)", [][]interface{}{
+//		{1, "apple"},
+//		{2, "pear"},
+//	})
+//
+// All rows are validated before any of them is executed: a row with the
+// wrong number of values or a value which does not fit its parameter
+// (such as a value of an unsupported type or text which is not a number
+// for a numeric column) fails the batch with a *BatchError listing every
+// invalid row.
+// Outside of a transaction the rows are executed in one which is rolled
+// back if any of them fails so that the batch is applied completely or
+// not at all. Returns the number of rows affected.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) ExecBatch(ctx context.Context, query string, rows [][]interface{}) (n int64, err error) {
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+	s, err := cn.Prepare(query)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+	st := s.(*stmt)
+	if err = st.validateBatch(rows); err != nil {
+		return 0, err
+	}
+	defer cn.watchCancel(ctx)()
+	batched := cn.autocommit
+	if batched {
+		if err = cn.cn.executeImmediate("BEGIN TRAN"); err != nil {
+			return 0, err
+		}
+	}
+	for _, row := range rows {
+		vals := make([]driver.Value, len(row))
+		for i, v := range row {
+			vals[i] = v
+		}
+		if err = st.execute(vals); err != nil {
+			err = cn.ctxErr(ctx, err)
+			break
+		}
+		if affected := st.st.affectedRows(); affected > 0 {
+			n += int64(affected)
+		}
+	}
+	switch {
+	case !batched:
+	case err == nil && cn.cn.commit():
+	default:
+		if err == nil {
+			err = cn.cn.newError()
+		}
+		_ = cn.cn.rollback() // the batch error is reported
+		n = 0
+	}
+	return n, err
+}
+
+// Checks all the rows of a batch against the parameters of the
+// statement
+func (st *stmt) validateBatch(rows [][]interface{}) error {
+	types := make([]dataType, st.numparams)
+	for i := range types {
+		bp := &bindParam{}
+		if ok := st.st.describeBindParam(sacapi_u32(i), bp); !ok {
+			return st.cn.cn.newError()
+		}
+		types[i] = bp.value.datatype
+	}
+	var invalid []RowError
+	for i, row := range rows {
+		if err := checkBatchRow(row, types); err != nil {
+			invalid = append(invalid, RowError{Index: i, Err: err})
+		}
+	}
+	if len(invalid) > 0 {
+		return &BatchError{Rows: invalid}
+	}
+	return nil
+}
+
+func checkBatchRow(row []interface{}, types []dataType) error {
+	if len(row) != len(types) {
+		return fmt.Errorf("%d values, expected %d", len(row), len(types))
+	}
+	for i, v := range row {
+		v, err := bindable(v)
+		if err != nil {
+			return fmt.Errorf("value %d: %v", i+1, err)
+		}
+		if err = checkBatchValue(v, types[i]); err != nil {
+			return fmt.Errorf("value %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Checks that the value can be bound to a parameter of the data type
+// suggested by the server
+func checkBatchValue(v interface{}, dt dataType) error {
+	numeric := dt != A_STRING && dt != A_BINARY && dt != A_INVALID_TYPE
+	switch x := v.(type) {
+	case nil, TypedValue, json.Number:
+		return nil
+	case []rune:
+		return checkBatchValue(string(x), dt)
+	case time.Time, []byte:
+		if numeric {
+			return fmt.Errorf("%T for a numeric parameter", v)
+		}
+		return nil
+	case string:
+		if _, err := strconv.ParseFloat(strings.TrimSpace(x), 64); numeric && err != nil {
+			return fmt.Errorf("%q is not a number", x)
+		}
+		return nil
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return nil
+	case reflect.String:
+		return checkBatchValue(reflect.ValueOf(v).String(), dt)
+	}
+	return fmt.Errorf("unsupported type %T", v)
+}
+
+// UnloadOptions configures the text written by Unload
+type UnloadOptions struct {
+	// Separates the values of a row, a comma if empty
+	Delimiter string
+	// Encloses string values, a double quote if empty
+	Quote string
+	// Write a first line with the column names
+	Header bool
+}
+
+// numbers the connection-scoped variables Unload collects the rows in so
+// that a variable left behind (if dropping it failed) does not clash
+var unloadSeq uint64
+
+// Unload writes the rows of the query to w as delimited text (one line
+// per row) and returns the number of bytes written (including the
+// header), e.g.
+//
+//	n, err := cn.Unload(ctx, "select * from items", f, sqlany.UnloadOptions{Header: true})
+//
+// The rows are formatted by the server with UNLOAD and sent over in large
+// chunks which is much faster than scanning them one by one for exports.
+// The query can not have parameters. The server holds the formatted rows
+// in memory until they have been written.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) Unload(ctx context.Context, query string, w io.Writer, opts UnloadOptions) (n int64, err error) {
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+	delim, quote := opts.Delimiter, opts.Quote
+	if delim == "" {
+		delim = ","
+	}
+	if quote == "" {
+		quote = `"`
+	}
+	defer cn.watchCancel(ctx)()
+	unloadVar := fmt.Sprintf("sqla_unload_%d", atomic.AddUint64(&unloadSeq, 1))
+	if opts.Header {
+		s, err := cn.Prepare(query)
+		if err != nil {
+			return 0, err
+		}
+		st := s.(*stmt)
+		err = st.describe()
+		cols := st.cols
+		s.Close()
+		if err != nil {
+			return 0, err
+		}
+		names := make([]string, len(cols))
+		for i, c := range cols {
+			names[i] = quote + strings.Replace(c, quote, quote+quote, -1) + quote
+		}
+		written, err := io.WriteString(w, strings.Join(names, delim)+"\n")
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+	if err = cn.cn.executeImmediate("CREATE VARIABLE " + unloadVar + " LONG VARCHAR"); err != nil {
+		return n, err
+	}
+	defer func() {
+		if err := cn.cn.executeImmediate("DROP VARIABLE " + unloadVar); err != nil {
+			cn.cfg.logger().Print("sqla: failed to drop unload variable: ", err)
+		}
+	}()
+	err = cn.cn.executeImmediate(fmt.Sprintf("UNLOAD %s INTO VARIABLE %s DELIMITED BY %s QUOTE %s ROW DELIMITED BY %s",
+		query, unloadVar, QuoteLiteral(delim), QuoteLiteral(quote), QuoteLiteral("\n")))
+	if err != nil {
+		return n, cn.ctxErr(ctx, err)
+	}
+	cn.stats.Queries++
+
+	st, err := cn.cn.executeDirect("SELECT " + unloadVar)
+	if err != nil {
+		return n, cn.ctxErr(ctx, err)
+	}
+	defer st.free()
+	if !st.fetchNext() {
+		if err = cn.fetchError(); err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, cn.ctxErr(ctx, err)
+	}
+	buf := make([]byte, 64<<10)
+	for offset := 0; ; {
+		size := st.getData(0, uintptr(offset), buf)
+		if size < 0 {
+			return n, cn.ctxErr(ctx, cn.cn.newError())
+		}
+		if size == 0 {
+			return n, nil
+		}
+		written, err := w.Write(buf[:size])
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+		offset += size
+	}
+}
@@ -0,0 +1,179 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// result set and statement metadata
+
+import (
+	"database/sql"
+	"reflect"
+	"time"
+)
+
+// ColumnMeta describes a single result set column
+type ColumnMeta struct {
+	Name       string
+	NativeType int          // SQL Anywhere native type code (DT_*)
+	GoType     reflect.Type // type of the values returned for the column
+	Length     int64        // maximum size of the column value in bytes
+	CharLength int64        // declared length of string columns (see ColumnTypeLength), 0 for other types
+	Precision  int
+	Scale      int
+	Nullable   bool
+}
+
+// ParamMeta describes a single statement parameter
+type ParamMeta struct {
+	Name   string       // as reported by the server
+	Input  bool         // the value is sent to the server
+	Output bool         // a value is returned (OUT/INOUT parameters of procedures)
+	GoType reflect.Type // type of values the server expects
+}
+
+// StmtInfo describes a statement (see Describe)
+type StmtInfo struct {
+	Params  []ParamMeta
+	Columns []ColumnMeta // of the (first) result set, empty if none
+}
+
+func (bp *bindParam) meta() ParamMeta {
+	m := ParamMeta{
+		Input:  bp.dir == DD_INPUT || bp.dir == DD_INPUT_OUTPUT,
+		Output: bp.dir == DD_OUTPUT || bp.dir == DD_INPUT_OUTPUT,
+		GoType: bp.value.datatype.goType(),
+	}
+	if bp.name != nil {
+		m.Name = bytePtrToString(bp.name)
+	}
+	return m
+}
+
+// snapshot of the column info - the name buffer is owned by the
+// statement and only valid until the next native call
+func (ci *columnInfo) meta() ColumnMeta {
+	return ColumnMeta{
+		Name:       ci.Name(),
+		NativeType: int(ci.nativetype),
+		GoType:     ci.goType(),
+		Length:     int64(ci.maxsize),
+		CharLength: ci.charLength(),
+		Precision:  int(ci.precision),
+		Scale:      int(ci.scale),
+		Nullable:   ci.nullable != 0,
+	}
+}
+
+// NCHAR values are stored in UTF-8 and their declared length is in
+// characters - the size the C API reports for them is that of the
+// longest value, the declared length times the longest UTF-8 sequence
+const maxNationalCharSize = 4
+
+// Declared length of the string values of the column. CHAR and VARCHAR
+// lengths are declared in bytes (SQL Anywhere's default byte-length
+// semantics) so with a multibyte character set the length is an upper
+// bound of the number of characters rather than the number itself.
+// NCHAR lengths are declared in characters.
+func (ci *columnInfo) charLength() int64 {
+	switch ci.nativetype {
+	case DT_VARCHAR, DT_FIXCHAR, DT_STRING, DT_LONGVARCHAR:
+		return int64(ci.maxsize)
+	case DT_NVARCHAR, DT_NFIXCHAR, DT_NSTRING, DT_LONGNVARCHAR:
+		return int64(ci.maxsize) / maxNationalCharSize
+	}
+	return 0
+}
+
+var (
+	typeBytes   = reflect.TypeOf([]byte(nil))
+	typeString  = reflect.TypeOf("")
+	typeFloat64 = reflect.TypeOf(float64(0))
+	typeFloat32 = reflect.TypeOf(float32(0))
+	typeInt64   = reflect.TypeOf(int64(0))
+	typeUint64  = reflect.TypeOf(uint64(0))
+	typeInt32   = reflect.TypeOf(int32(0))
+	typeUint32  = reflect.TypeOf(uint32(0))
+	typeInt16   = reflect.TypeOf(int16(0))
+	typeUint16  = reflect.TypeOf(uint16(0))
+	typeInt8    = reflect.TypeOf(int8(0))
+	typeUint8   = reflect.TypeOf(uint8(0))
+	typeTime    = reflect.TypeOf(time.Time{})
+	typeBool    = reflect.TypeOf(false)
+
+	typeNullString  = reflect.TypeOf(sql.NullString{})
+	typeNullFloat64 = reflect.TypeOf(sql.NullFloat64{})
+	typeNullInt64   = reflect.TypeOf(sql.NullInt64{})
+	typeNullTime    = reflect.TypeOf(sql.NullTime{})
+	typeNullBool    = reflect.TypeOf(sql.NullBool{})
+)
+
+// Type of a destination the values of the column can be scanned into.
+// For nullable columns this is the matching sql.Null* type (or a
+// pointer if there's none) so that NULLs can be scanned as well.
+func (m *ColumnMeta) scanType() reflect.Type {
+	if !m.Nullable || m.GoType == nil {
+		return m.GoType
+	}
+	switch m.GoType {
+	case typeBytes:
+		// scans NULL as nil
+		return typeBytes
+	case typeString:
+		return typeNullString
+	case typeFloat64, typeFloat32:
+		return typeNullFloat64
+	case typeInt64, typeInt32, typeUint32, typeInt16, typeUint16, typeInt8, typeUint8:
+		return typeNullInt64
+	case typeTime:
+		return typeNullTime
+	case typeBool:
+		return typeNullBool
+	}
+	// i.e. uint64 which does not fit into sql.NullInt64
+	return reflect.PtrTo(m.GoType)
+}
+
+// Go type of the values returned for the column
+func (ci *columnInfo) goType() reflect.Type {
+	switch {
+	case isTemporal(ci.nativetype):
+		return typeTime
+	case ci.nativetype == DT_FLOAT:
+		return typeFloat32
+	case ci.nativetype == DT_DOUBLE:
+		return typeFloat64
+	case ci.nativetype == DT_TINYINT:
+		return typeUint8
+	}
+	return ci.datatype.goType()
+}
+
+// Go type of the values dataValue.Value() produces for the data type
+func (dt dataType) goType() reflect.Type {
+	switch dt {
+	case A_BINARY:
+		return typeBytes
+	case A_STRING:
+		return typeString
+	case A_DOUBLE:
+		return typeFloat64
+	case A_VAL64:
+		return typeInt64
+	case A_UVAL64:
+		return typeUint64
+	case A_VAL32:
+		return typeInt32
+	case A_UVAL32:
+		return typeUint32
+	case A_VAL16:
+		return typeInt16
+	case A_UVAL16:
+		return typeUint16
+	case A_VAL8:
+		return typeInt8
+	case A_UVAL8:
+		return typeUint8
+	case A_FLOAT:
+		return typeFloat32
+	}
+	return nil
+}
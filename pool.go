@@ -0,0 +1,60 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// connection pool helpers
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Warmup opens and pings n connections concurrently to fill the pool
+// before traffic arrives.
+// n is capped at the limit set with db.SetMaxOpenConns. For the
+// connections to stay in the pool afterwards db.SetMaxIdleConns must
+// allow for n idle connections (the default is 2). Does nothing if n is
+// not positive.
+// Returns the first error encountered.
+func Warmup(ctx context.Context, db *sql.DB, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	if max := db.Stats().MaxOpenConnections; max > 0 && n > max {
+		n = max
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	conns := make([]*sql.Conn, n)
+	for i := range conns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := db.Conn(ctx)
+			if err == nil {
+				conns[i] = c
+				err = c.PingContext(ctx)
+			}
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	// connections are only returned to the pool once all have been
+	// opened, otherwise they'd be reused by the other goroutines
+	for _, c := range conns {
+		if c != nil {
+			c.Close()
+		}
+	}
+	return firstErr
+}
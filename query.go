@@ -0,0 +1,348 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// query building helpers
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExpandIn expands the placeholders of slice arguments so that
+//
+//	ExpandIn("select * from t where id in (?)", []int{1, 2, 3})
+//
+// becomes
+//
+//	"select * from t where id in (?,?,?)", []interface{}{1, 2, 3}
+//
+// Scalar arguments and byte slices are left untouched. An empty slice
+// is replaced with NULL (which matches nothing).
+func ExpandIn(query string, args ...interface{}) (string, []interface{}) {
+	var b strings.Builder
+	out := make([]interface{}, 0, len(args))
+	n := 0
+	last := 0
+	scanPlaceholders(query, func(pos int) {
+		if n >= len(args) {
+			return
+		}
+		arg := args[n]
+		n++
+		v := reflect.ValueOf(arg)
+		if !isExpandable(v) {
+			out = append(out, arg)
+			return
+		}
+		b.WriteString(query[last:pos])
+		last = pos + 1
+		if v.Len() == 0 {
+			b.WriteString("NULL")
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('?')
+			out = append(out, v.Index(i).Interface())
+		}
+	})
+	b.WriteString(query[last:])
+	return b.String(), append(out, args[n:]...)
+}
+
+// replaces the placeholders of the query with the arguments formatted as
+// literals (time.Time values in the time zone and with the layout they
+// are bound with)
+func inlineArgs(query string, args []interface{}, cfg *Config) (string, error) {
+	var b strings.Builder
+	var err error
+	n := 0
+	last := 0
+	scanPlaceholders(query, func(pos int) {
+		if err != nil || n >= len(args) {
+			n++
+			return
+		}
+		var lit string
+		if lit, err = literal(args[n], cfg); err != nil {
+			return
+		}
+		n++
+		b.WriteString(query[last:pos])
+		b.WriteString(lit)
+		last = pos + 1
+	})
+	if err != nil {
+		return "", err
+	}
+	if n != len(args) {
+		return "", fmt.Errorf("sqla: query has %d placeholders, got %d arguments", n, len(args))
+	}
+	b.WriteString(query[last:])
+	return b.String(), nil
+}
+
+// formats the value as an SQL literal
+func literal(arg interface{}, cfg *Config) (string, error) {
+	v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case []byte:
+		if len(v) == 0 {
+			return "''", nil
+		}
+		return "0x" + hex.EncodeToString(v), nil
+	case string:
+		return QuoteLiteral(v), nil
+	case time.Time:
+		return QuoteLiteral(v.In(cfg.location()).Format(cfg.timestampFormat())), nil
+	}
+	return "", fmt.Errorf("sqla: cannot format %T as a literal", arg)
+}
+
+func isExpandable(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice:
+		return v.Type().Elem().Kind() != reflect.Uint8
+	case reflect.Array:
+		// byte arrays (such as UUIDs) are bound as binary values
+		return !isByteArray(v.Type())
+	}
+	return false
+}
+
+// invokes fn with the offset of each `?` placeholder outside of string
+// literals, quoted identifiers and comments (`--`, `//` and `/* */`)
+func scanPlaceholders(query string, fn func(pos int)) {
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '\'', '"':
+			for i++; i < len(query) && query[i] != c; i++ {
+			}
+		case '-':
+			if strings.HasPrefix(query[i:], "--") {
+				for ; i < len(query) && query[i] != '\n'; i++ {
+				}
+			}
+		case '/':
+			if strings.HasPrefix(query[i:], "//") {
+				for ; i < len(query) && query[i] != '\n'; i++ {
+				}
+			} else if strings.HasPrefix(query[i:], "/*") {
+				end := strings.Index(query[i+2:], "*/")
+				if end < 0 {
+					return
+				}
+				i += end + 3
+			}
+		case '?':
+			fn(i)
+		}
+	}
+}
+
+// the FOR clause specifying the cursor type of a query
+var forClauseRe = regexp.MustCompile(`(?is)\bfor\s+(?:read\s+only|update|xml|json)\b`)
+
+// Adds a FOR READ ONLY clause to a query so that the server opens a
+// read-only cursor for it. The clause goes before a trailing `;` or
+// comment. Queries with an INTO clause (which do not open a cursor) or a
+// FOR clause of their own are returned as they are.
+func readOnlyQuery(query string) string {
+	if forClauseRe.MatchString(query) {
+		return query
+	}
+	end := 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"':
+			for i++; i < len(query) && query[i] != c; i++ {
+			}
+			end = i + 1
+		case strings.HasPrefix(query[i:], "--"), strings.HasPrefix(query[i:], "//"):
+			for ; i < len(query) && query[i] != '\n'; i++ {
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			n := strings.Index(query[i+2:], "*/")
+			if n < 0 {
+				i = len(query)
+				break
+			}
+			i += n + 3
+		case c == ';', c == ' ', c == '\t', c == '\r', c == '\n':
+		case isWordChar(c) && (i == 0 || !isWordChar(query[i-1])):
+			j := i
+			for j < len(query) && isWordChar(query[j]) {
+				j++
+			}
+			if strings.EqualFold(query[i:j], "into") {
+				return query
+			}
+			i = j - 1
+			end = j
+		default:
+			end = i + 1
+		}
+	}
+	if end > len(query) {
+		end = len(query)
+	}
+	return query[:end] + " FOR READ ONLY" + query[end:]
+}
+
+// Splits a script into statements on `;` and lines consisting of `go`
+// alone. Separators within string literals, quoted identifiers,
+// comments and BEGIN ... END (or CASE ... END) blocks are ignored.
+// Empty statements are dropped.
+func splitScript(script string) (stmts []string) {
+	var depth int
+	start := 0
+	add := func(end int) {
+		if s := strings.TrimSpace(script[start:end]); s != "" {
+			stmts = append(stmts, s)
+		}
+	}
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"':
+			for i++; i < len(script) && script[i] != c; i++ {
+			}
+		case strings.HasPrefix(script[i:], "--"), strings.HasPrefix(script[i:], "//"):
+			for ; i < len(script) && script[i] != '\n'; i++ {
+			}
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+				break
+			}
+			i += end + 3
+		case c == ';':
+			if depth == 0 {
+				add(i)
+				start = i + 1
+			}
+		case isWordChar(c) && (i == 0 || !isWordChar(script[i-1])):
+			j := i
+			for j < len(script) && isWordChar(script[j]) {
+				j++
+			}
+			switch strings.ToLower(script[i:j]) {
+			case "begin":
+				switch strings.ToLower(nextWord(script[j:])) {
+				case "tran", "transaction":
+					// a statement on its own
+				default:
+					depth++
+				}
+			case "case":
+				depth++
+			case "end":
+				// the keyword after END (as in END IF or END CASE) is
+				// skipped so that it is not taken for an opener
+				next := nextWord(script[j:])
+				switch strings.ToLower(next) {
+				case "if", "loop", "for", "while":
+					// closes a control statement which did not open a block
+				default:
+					if depth > 0 {
+						depth--
+					}
+				}
+				switch strings.ToLower(next) {
+				case "if", "case", "loop", "for", "while":
+					j = strings.Index(script[j:], next) + j + len(next)
+				}
+			case "go":
+				if depth == 0 && onOwnLine(script, i, j) {
+					add(i)
+					start = j
+				}
+			}
+			i = j - 1
+		}
+	}
+	add(len(script))
+	return
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// first word of s after leading whitespace
+func nextWord(s string) string {
+	s = strings.TrimLeft(s, " \t\r\n")
+	i := 0
+	for i < len(s) && isWordChar(s[i]) {
+		i++
+	}
+	return s[:i]
+}
+
+// reports whether s[start:end] is the only text on its line
+func onOwnLine(s string, start, end int) bool {
+	line := strings.LastIndexByte(s[:start], '\n') + 1
+	if strings.TrimSpace(s[line:start]) != "" {
+		return false
+	}
+	rest := s[end:]
+	if i := strings.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[:i]
+	}
+	return strings.TrimSpace(rest) == ""
+}
+
+// QuoteIdentifier quotes s for use as an identifier (such as a table or
+// column name) in a query, e.g. `my "table"` becomes `"my ""table"""`.
+// Double-quoted identifiers require the quoted_identifier option to be On
+// (the default) - with it Off they are string literals.
+func QuoteIdentifier(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// quotes a table name which may be qualified with its owner (such as
+// `dba.items`) part by part
+func quoteQualified(name string) string {
+	parts := strings.SplitN(name, ".", 2)
+	for i, p := range parts {
+		parts[i] = QuoteIdentifier(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// QuoteLiteral quotes s for use as a string literal in a query with
+// embedded single quotes doubled, e.g.
+//
+//	QuoteLiteral("it's") == "'it''s'"
+//
+// Backslashes are doubled as well as the server interprets escape
+// sequences (such as \n) in string literals.
+func QuoteLiteral(s string) string {
+	return "'" + literalReplacer.Replace(s) + "'"
+}
+
+var literalReplacer = strings.NewReplacer(`'`, `''`, `\`, `\\`)
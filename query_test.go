@@ -0,0 +1,154 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpandIn(t *testing.T) {
+	query, args := ExpandIn("SELECT a FROM t WHERE b = ? AND a IN (?) AND c = '?'", "x", []int{1, 2, 3})
+	if want := "SELECT a FROM t WHERE b = ? AND a IN (?,?,?) AND c = '?'"; query != want {
+		t.Fatalf("expected %q, got %q", want, query)
+	}
+	if want := []interface{}{"x", 1, 2, 3}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("expected args %v, got %v", want, args)
+	}
+
+	query, args = ExpandIn("SELECT a FROM t WHERE a IN (?) AND b = ?", []string{}, []byte("b"))
+	if want := "SELECT a FROM t WHERE a IN (NULL) AND b = ?"; query != want {
+		t.Fatalf("expected %q, got %q", want, query)
+	}
+	if want := []interface{}{[]byte("b")}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("expected args %v, got %v", want, args)
+	}
+
+	query, args = ExpandIn("SELECT a FROM t // where a in (?)\nWHERE a IN (?) -- ?\n/* ? */", []int{1, 2})
+	if want := "SELECT a FROM t // where a in (?)\nWHERE a IN (?,?) -- ?\n/* ? */"; query != want {
+		t.Fatalf("expected %q, got %q", want, query)
+	}
+
+	uuid := [16]byte{1, 2, 3}
+	query, args = ExpandIn("SELECT a FROM t WHERE id = ? AND a IN (?)", uuid, [2]int{1, 2})
+	if want := "SELECT a FROM t WHERE id = ? AND a IN (?,?)"; query != want {
+		t.Fatalf("expected %q, got %q", want, query)
+	}
+	if want := []interface{}{uuid, 1, 2}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("expected args %v, got %v", want, args)
+	}
+}
+
+func TestSplitScript(t *testing.T) {
+	script := `CREATE TABLE t (a VARCHAR(10)); -- a comment; not a separator
+INSERT INTO t VALUES ('x;y');
+/* ; */ INSERT INTO t VALUES ('z')
+go
+CREATE PROCEDURE p()
+BEGIN
+	IF 1 = 1 THEN
+		SELECT CASE WHEN 1 = 1 THEN 1 ELSE 0 END;
+	END IF;
+	CASE 1
+	WHEN 1 THEN SELECT 1;
+	END CASE;
+	BEGIN TRANSACTION;
+END;
+BEGIN TRAN;
+`
+	want := []string{
+		"CREATE TABLE t (a VARCHAR(10))",
+		"-- a comment; not a separator\nINSERT INTO t VALUES ('x;y')",
+		"/* ; */ INSERT INTO t VALUES ('z')",
+		"CREATE PROCEDURE p()\nBEGIN\n\tIF 1 = 1 THEN\n\t\tSELECT CASE WHEN 1 = 1 THEN 1 ELSE 0 END;\n\tEND IF;\n\tCASE 1\n\tWHEN 1 THEN SELECT 1;\n\tEND CASE;\n\tBEGIN TRANSACTION;\nEND",
+		"BEGIN TRAN",
+	}
+	if got := splitScript(script); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestReadOnlyQuery(t *testing.T) {
+	for query, want := range map[string]string{
+		"SELECT a FROM t":                  "SELECT a FROM t FOR READ ONLY",
+		"SELECT a FROM t;\n":               "SELECT a FROM t FOR READ ONLY;\n",
+		"SELECT 'x;' FROM t -- comment":    "SELECT 'x;' FROM t FOR READ ONLY -- comment",
+		"SELECT a FROM t /* c */ ;":        "SELECT a FROM t FOR READ ONLY /* c */ ;",
+		"SELECT a INTO v FROM t":           "SELECT a INTO v FROM t",
+		"SELECT a FROM t FOR UPDATE":       "SELECT a FROM t FOR UPDATE",
+		"SELECT a FROM t WHERE b = 'into'": "SELECT a FROM t WHERE b = 'into' FOR READ ONLY",
+		`SELECT "a" FROM t ORDER BY "a"`:   `SELECT "a" FROM t ORDER BY "a" FOR READ ONLY`,
+	} {
+		if got := readOnlyQuery(query); got != want {
+			t.Errorf("expected %q for %q, got %q", want, query, got)
+		}
+	}
+}
+
+func TestQuoteQualified(t *testing.T) {
+	for name, want := range map[string]string{
+		"items":         `"items"`,
+		"dba.items":     `"dba"."items"`,
+		`dba.my "item"`: `"dba"."my ""item"""`,
+	} {
+		if got := quoteQualified(name); got != want {
+			t.Errorf("expected %s for %q, got %s", want, name, got)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for s, want := range map[string]string{
+		"":          `""`,
+		"name":      `"name"`,
+		`my "name"`: `"my ""name"""`,
+		`it's`:      `"it's"`,
+	} {
+		if got := QuoteIdentifier(s); got != want {
+			t.Errorf("expected %s for identifier %q, got %s", want, s, got)
+		}
+	}
+	for s, want := range map[string]string{
+		"":         `''`,
+		"text":     `'text'`,
+		`it's`:     `'it''s'`,
+		`''`:       `''''''`,
+		`a\nb`:     `'a\\nb'`,
+		`say "hi"`: `'say "hi"'`,
+	} {
+		if got := QuoteLiteral(s); got != want {
+			t.Errorf("expected %s for literal %q, got %s", want, s, got)
+		}
+	}
+}
+
+func TestInlineArgs(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	n := 7
+	query, err := inlineArgs("SELECT * FROM t WHERE a = ? AND b = '?' AND c IN (?, ?, ?, ?, ?, ?)",
+		[]interface{}{"it's", 42, 1.5, nil, []byte{0xca, 0xfe}, ts, &n}, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT * FROM t WHERE a = 'it''s' AND b = '?' AND c IN (42, 1.5, NULL, 0xcafe, '2020-01-02 03:04:05.000000', 7)"
+	if query != want {
+		t.Fatalf("expected %q, got %q", want, query)
+	}
+	if _, err = inlineArgs("SELECT ?", nil, &Config{}); err == nil {
+		t.Fatal("expected an error for a missing argument")
+	}
+	if _, err = inlineArgs("SELECT 1", []interface{}{1}, &Config{}); err == nil {
+		t.Fatal("expected an error for an extra argument")
+	}
+
+	// converted to the configured location as bound values are
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	query, err = inlineArgs("SELECT ?", []interface{}{ts}, &Config{Location: loc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SELECT '2020-01-02 05:04:05.000000'"; query != want {
+		t.Fatalf("expected %q, got %q", want, query)
+	}
+}
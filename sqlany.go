@@ -3,70 +3,345 @@
 package sqlany
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"math"
 	"reflect"
-	"syscall"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 	"unsafe"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 var (
 	ErrNotSupported = errors.New("sqla: not supported")
+	ErrForwardOnly  = errors.New("sqla: cursor is forward-only")
+	// returned by RowsAffected for statements which do not report a count
+	ErrNoRowsAffected = errors.New("sqla: no affected rows available")
+	// returned for statements other than queries on read-only
+	// connections (see Config.ReadOnly)
+	ErrReadOnly = errors.New("sqla: connection is read-only")
+	// returned by Next for rows which took longer than
+	// Config.FetchTimeout to fetch
+	ErrFetchTimeout = errors.New("sqla: fetch timed out")
+)
+
+// DriverName is the name the driver is registered with database/sql
+const DriverName = "sqlany"
+
+// Bind variable styles in terms of github.com/jmoiron/sqlx (whose
+// BindDriver takes an int)
+const (
+	// positional `?` placeholders, sqlx.QUESTION
+	BindQuestion int = 1
 )
 
+// BindType is the bind variable style of the driver (BindQuestion).
+// Register it with sqlx so that named queries (NamedExec, NamedQuery)
+// are rewritten accordingly:
+//
+//	sqlx.BindDriver(sqlany.DriverName, sqlany.BindType)
+const BindType = BindQuestion
+
 func init() {
-	sql.Register("sqlany", &drv{})
-	sqlaInit("sqlago")
+	sql.Register(DriverName, &drv{})
+	version, _ := sqlaInit("sqlago")
+	capabilities = newCapabilities(version, clientVersion())
 }
 
 // database driver
 type drv struct {
 }
 
-func (d *drv) Open(opts string) (_ driver.Conn, err error) {
+func (d *drv) Open(dsn string) (driver.Conn, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return open(context.Background(), cfg, nil)
+}
+
+// OpenConnector implements driver.DriverContext
+func (d *drv) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewConnector(cfg)
+}
+
+// NewConnector returns a connector for use with sql.OpenDB which allows
+// configuring what can't be expressed in a connection string (such as
+// the Logger)
+func NewConnector(cfg *Config) (driver.Connector, error) {
+	if cfg.Encryption != nil {
+		if err := cfg.Encryption.validate(); err != nil {
+			return nil, fmt.Errorf("sqla: invalid encryption: %v", err)
+		}
+	}
+	c := &connector{cfg: cfg}
+	if cfg.StmtCache > 0 {
+		c.meta = newMetaCache(cfg.StmtCache)
+	}
+	return c, nil
+}
+
+type connector struct {
+	cfg *Config
+	// column metadata shared by the connections (see Config.StmtCache)
+	meta *metaCache
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return open(ctx, c.cfg, c.meta)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return &drv{}
+}
+
+// Connects and sets up the connection. The queries following the connect
+// are canceled once ctx is done. meta is the metadata cache shared with
+// the other connections of the connector (nil if none).
+func open(ctx context.Context, cfg *Config, meta *metaCache) (_ *conn, err error) {
+	if err = cfg.validateTimestampFormat(); err != nil {
+		return
+	}
+	if err = cfg.validateDateOptions(); err != nil {
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	h := newConnection()
-	// [ap]: augment the connection options string to instruct the server
-	// to perform character set conversions and return strings in utf-8
-	err = h.connect(opts + ";cs=utf8")
+	err = h.connect(cfg.connString())
 	if err != nil {
+		h.free()
 		return
 	}
-	c := &conn{cn: h, connected: true, charset: "utf-8"}
-	// query the character set
-	var cs string
-	if err = c.queryRow("select connection_property('CharSet')", &cs); err == nil {
-		c.charset = cs
+	c := &conn{cn: h, cfg: cfg, connected: true, charset: "utf-8", autocommit: true}
+	if cfg.StmtCache > 0 {
+		c.stmts = newStmtCache(cfg.StmtCache)
+		c.meta = meta
+	}
+	stop := c.watchCancel(ctx)
+	opterr := c.setIsolation()
+	if opterr == nil {
+		opterr = c.setDateOptions()
+	}
+	if opterr == nil {
+		opterr = c.setCharSet()
+	}
+	if opterr == nil {
+		opterr = c.checkServerReadOnly()
+	}
+	stop()
+	if ctxerr := ctx.Err(); ctxerr != nil || opterr != nil {
+		// the connection is not handed out
+		c.Close()
+		if ctxerr != nil {
+			return nil, ctxerr
+		}
+		return nil, opterr
+	}
+	return c, nil
+}
+
+// Sets the configured default isolation level
+func (cn *conn) setIsolation() error {
+	if cn.cfg.DefaultIsolation == sql.LevelDefault {
+		return nil
+	}
+	opt, ok := isolationOptions[cn.cfg.DefaultIsolation]
+	if !ok {
+		return fmt.Errorf("sqla: unsupported isolation level %v", cn.cfg.DefaultIsolation)
+	}
+	return cn.cn.executeImmediate("SET TEMPORARY OPTION isolation_level = '" + opt + "'")
+}
+
+// Sets the configured date_format and date_order options
+func (cn *conn) setDateOptions() error {
+	if f := cn.cfg.DateFormat; f != "" {
+		if err := cn.cn.executeImmediate("SET TEMPORARY OPTION date_format = " + QuoteLiteral(f)); err != nil {
+			return err
+		}
+	}
+	if order := cn.cfg.DateOrder; order != "" {
+		return cn.cn.executeImmediate("SET TEMPORARY OPTION date_order = " + QuoteLiteral(strings.ToUpper(order)))
 	}
-	return c, err
+	return nil
+}
+
+// Determines the character set of the connection
+func (cn *conn) setCharSet() error {
+	switch {
+	case cn.cfg.CharSet != "":
+		// trust the explicitly configured character set
+		cn.charset = cn.cfg.CharSet
+	case !cn.cfg.SkipCharSetQuery:
+		// query the character set
+		var cs string
+		if err := cn.queryRow("select connection_property('CharSet')", &cs); err != nil {
+			return err
+		}
+		cn.charset = cs
+	}
+	return nil
+}
+
+// Checks on a read-only connection (see Config.ReadOnly) whether the
+// server enforces it. SQL Anywhere has no read-only mode for a single
+// connection - only the database as a whole can be started read-only -
+// so unless it is, the driver's check of the statements is all there is
+// and this is logged once per connection.
+func (cn *conn) checkServerReadOnly() error {
+	if !cn.cfg.ReadOnly {
+		return nil
+	}
+	var ro string
+	if err := cn.queryRow("select db_property('ReadOnly')", &ro); err != nil {
+		return err
+	}
+	if !strings.EqualFold(ro, "on") {
+		cn.cfg.logger().Print("sqla: the database is not read-only - the read-only connection is only enforced by the driver")
+	}
+	return nil
 }
 
+// Connections are used by one goroutine at a time by database/sql.
+// Code driving a connection directly may share it between goroutines -
+// mu serializes Begin, Prepare, Close (of the connection and its
+// statements) and the internal queries so that they do not race on the
+// native handle and the connection state. Executing statements and
+// iterating rows still has to be serialized by the caller.
 type conn struct {
+	// uncontended when used through database/sql
+	mu        sync.Mutex
 	cn        sqlaConn // low-level connection handle
-	t         *tx
+	cfg       *Config
+	t         *tx // active transaction (nil in autocommit mode)
 	connected bool
 	charset   string
+	// NCHAR columns have been used with a non-Unicode character set
+	warnedNational bool
+	// incremented when the native connection is replaced (UseDatabase)
+	generation int
+	// counters reported by Stats
+	stats ConnStats
+	// true unless a transaction has been started with Begin
+	autocommit bool
+	// event subscriptions (see Subscribe)
+	events *eventHub
+	// idle prepared statements if enabled with Config.StmtCache
+	stmts *stmtCache
+	// column metadata shared with the other connections of the
+	// connector (nil once another database is used)
+	meta *metaCache
 }
 
 type tx struct {
 	cn *conn
+	// the isolation level has been set for the transaction and is to
+	// be restored once it ends
+	isolation bool
 }
 
+var errTxActive = errors.New("sqla: a transaction is already active")
+
 // Connection interface
 func (cn *conn) Begin() (driver.Tx, error) {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	return cn.begin(&tx{cn: cn})
+}
+
+// BeginTx implements driver.ConnBeginTx. The isolation level of the
+// transaction (if not the default) is set for its duration - the
+// connection's default (see Config.DefaultIsolation) is restored once it
+// ends. Read-only transactions are not supported.
+func (cn *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("sqla: read-only transactions are not supported")
+	}
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	t := &tx{cn: cn}
+	if level := sql.IsolationLevel(opts.Isolation); level != sql.LevelDefault {
+		opt, ok := isolationOptions[level]
+		if !ok {
+			return nil, fmt.Errorf("sqla: unsupported isolation level %v", level)
+		}
+		if cn.t != nil {
+			return nil, errTxActive
+		}
+		// set before the transaction starts as snapshots are taken
+		// when it does
+		if err := cn.cn.executeImmediate("SET TEMPORARY OPTION isolation_level = '" + opt + "'"); err != nil {
+			return nil, err
+		}
+		t.isolation = true
+	}
+	dtx, err := cn.begin(t)
+	if err != nil && t.isolation {
+		cn.restoreIsolation()
+	}
+	return dtx, err
+}
+
+// Starts the transaction unless there's one already - nested
+// transactions are not supported
+func (cn *conn) begin(t *tx) (driver.Tx, error) {
+	if cn.t != nil {
+		return nil, errTxActive
+	}
 	_, err := cn.cn.executeDirect("BEGIN TRAN")
 	if err != nil {
 		return nil, err
 	}
-	return &tx{cn: cn}, nil
+	cn.autocommit = false
+	cn.t = t
+	return t, nil
+}
+
+// Restores the default isolation level of the connection after a
+// transaction with another one
+func (cn *conn) restoreIsolation() {
+	var err error
+	if cn.cfg.DefaultIsolation == sql.LevelDefault {
+		// drops the temporary setting
+		err = cn.cn.executeImmediate("SET TEMPORARY OPTION isolation_level =")
+	} else {
+		err = cn.setIsolation()
+	}
+	if err != nil {
+		cn.cfg.logger().Print("sqla: failed to restore the isolation level: ", err)
+	}
 }
 
 func (cn *conn) Close() error {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	if cn.events != nil {
+		cn.events.close()
+		cn.events = nil
+	}
+	if cn.stmts != nil {
+		cn.stmts.clear()
+	}
 	if !cn.cn.disconnect() {
-		log.Print("sqla: error disconnecting")
+		cn.cfg.logger().Print("sqla: error disconnecting")
 	}
 
 	cn.cn.free()
@@ -74,28 +349,203 @@ func (cn *conn) Close() error {
 	return nil
 }
 
+// CheckNamedValue lets through the argument types bound natively which
+// database/sql would otherwise convert (float32 gets widened to float64
+// and json.Number turned into a string for instance) and output
+// parameters (sql.Out).
+// Fixed-size byte arrays (which database/sql rejects) are bound as
+// binary values and []rune as strings. Pointers bind what they point to (NULL if nil).
+// A []interface{} (such as the flattened values of a multi-row VALUES
+// clause) is kept as is with each element converted on its own - it
+// binds consecutive placeholders (see stmt.execute).
+// Everything else is converted by database/sql as usual.
+func (cn *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	vals, ok := nv.Value.([]interface{})
+	if !ok {
+		var err error
+		nv.Value, err = checkValue(nv.Value)
+		return err
+	}
+	elems := make([]interface{}, len(vals))
+	for i, v := range vals {
+		var err error
+		if elems[i], err = checkValue(v); err == driver.ErrSkip {
+			elems[i], err = driver.DefaultParameterConverter.ConvertValue(elems[i])
+		}
+		if err != nil {
+			return fmt.Errorf("sqla: element %d of the argument: %v", i, err)
+		}
+	}
+	nv.Value = elems
+	return nil
+}
+
+// Converts an argument bound natively (see CheckNamedValue).
+// Returns driver.ErrSkip along with the (dereferenced) value if it is
+// left to the default conversion. A driver.Valuer (including one with
+// a pointer receiver) is left to the default conversion as it is.
+func checkValue(value interface{}) (interface{}, error) {
+	for {
+		if _, ok := value.(driver.Valuer); ok {
+			return value, driver.ErrSkip
+		}
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Ptr {
+			break
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		value = v.Elem().Interface()
+	}
+	switch x := value.(type) {
+	case float32, sql.Out, json.Number, TypedValue:
+		return value, nil
+	case []rune:
+		return string(x), nil
+	case uint, uint8, uint16, uint32, uint64:
+		// database/sql rejects uint64 values beyond the int64 range
+		return value, nil
+	}
+	if v := reflect.ValueOf(value); v.IsValid() && isByteArray(v.Type()) {
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return b, nil
+	}
+	return value, driver.ErrSkip
+}
+
 func (cn *conn) Prepare(query string) (driver.Stmt, error) {
-	st, err := cn.cn.prepare(query)
+	if err := cn.checkReadOnly(query); err != nil {
+		return nil, err
+	}
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	if cn.stmts != nil {
+		if st := cn.stmts.get(query); st != nil {
+			return st, nil
+		}
+	}
+	native := query
+	fastForward := cn.cfg.Cursor == CursorFastForwardReadOnly && selectRe.MatchString(query)
+	if fastForward {
+		// the C API has no cursor flags - the server is asked for a
+		// read-only cursor with the statement itself while fetching
+		// forward only is up to the driver
+		native = readOnlyQuery(query)
+	}
+	st, err := cn.cn.prepare(native)
 	if err != nil {
+		if cn.lost(err) {
+			// nothing has been executed yet - database/sql retries on
+			// another connection
+			return nil, driver.ErrBadConn
+		}
+		if e, ok := err.(*sqlaError); ok {
+			e.locate(query)
+		}
 		return nil, err
 	}
 	numparams := st.numParams()
-	stmt := &stmt{st: st, cn: cn, numparams: numparams}
-	if numcols := st.numCols(); numcols > 0 {
-		colinfo := &columnInfo{}
-		cols := make([]string, numcols)
-		for i := 0; i < numcols; i++ {
-			if ok := st.getColumnInfo(sacapi_u32(i), colinfo); !ok {
-				err := cn.cn.newError()
-				return nil, err
-			}
-			cols[i] = colinfo.Name()
+	if max := cn.cfg.maxParams(); numparams > max {
+		st.free()
+		return nil, fmt.Errorf("sqla: statement has %d parameters, more than the limit of %d", numparams, max)
+	}
+	stmt := &stmt{st: st, cn: cn, query: query, numparams: numparams, forwardOnly: fastForward,
+		generation: cn.generation}
+	if !cn.cfg.LazyColumns {
+		if err = stmt.describe(); err != nil {
+			st.free()
+			return nil, err
 		}
-		stmt.cols = cols
 	}
 	return stmt, nil
 }
 
+// Describes the columns of the result set unless done already (see
+// Config.LazyColumns)
+func (st *stmt) describe() error {
+	st.describeMu.Lock()
+	defer st.describeMu.Unlock()
+	if st.described {
+		return nil
+	}
+	if m, ok := st.cn.meta.get(st.query); ok && len(m.cols) == st.st.numCols() {
+		// described on another connection - the column count guards
+		// against a changed schema
+		st.cols, st.meta, st.described = m.cols, m.meta, true
+		st.cn.checkNational(m.meta)
+		return nil
+	}
+	cols, meta, err := st.describeColumns()
+	if err != nil {
+		return err
+	}
+	st.cn.meta.put(st.query, stmtMeta{cols: cols, meta: meta})
+	st.cols, st.meta, st.described = cols, meta, true
+	st.cn.checkNational(meta)
+	return nil
+}
+
+// NCHAR/NVARCHAR values are converted to the connection character set
+// like any other string - which is lossless only for Unicode character
+// sets (utf8 is requested by default).
+// Warns once per connection if that's not the case.
+func (cn *conn) checkNational(meta []ColumnMeta) {
+	if cn.warnedNational || isUnicodeCharSet(cn.charset) {
+		return
+	}
+	for _, m := range meta {
+		if isNational(nativeType(m.NativeType)) {
+			cn.cfg.logger().Print(fmt.Sprintf("sqla: column %s is NCHAR but the connection character set %s is not Unicode",
+				m.Name, cn.charset))
+			cn.warnedNational = true
+			return
+		}
+	}
+}
+
+func isNational(typ nativeType) bool {
+	switch typ {
+	case DT_NSTRING, DT_NFIXCHAR, DT_NVARCHAR, DT_LONGNVARCHAR:
+		return true
+	}
+	return false
+}
+
+func isUnicodeCharSet(cs string) bool {
+	switch strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(cs)) {
+	case "utf8", "utf16", "utf16le", "utf16be", "ucs2":
+		return true
+	}
+	return false
+}
+
+// Describes the columns of the current result set
+func (st *stmt) describeColumns() (cols []string, meta []ColumnMeta, err error) {
+	numcols := st.st.numCols()
+	if numcols <= 0 {
+		return
+	}
+	colinfo := &columnInfo{}
+	cols = make([]string, numcols)
+	meta = make([]ColumnMeta, numcols)
+	for i := 0; i < numcols; i++ {
+		if ok := st.st.getColumnInfo(sacapi_u32(i), colinfo); !ok {
+			return nil, nil, st.cn.cn.newError()
+		}
+		meta[i] = colinfo.meta()
+		if colinfo.nativetype == DT_DECIMAL && st.cn.cfg.DecimalAs == DecimalAsFloat {
+			meta[i].GoType = typeFloat64
+		}
+		if colinfo.nativetype == DT_BIT && st.cn.cfg.BitAsBool {
+			meta[i].GoType = typeBool
+		}
+		cols[i] = meta[i].Name
+	}
+	return
+}
+
 // Special purpose restricted query implementation that only knows
 // about strings/ints
 //
@@ -108,12 +558,17 @@ func (cn *conn) Prepare(query string) (driver.Stmt, error) {
 // Imagine having to use database/sql inside of the driver implementation
 // and you'll get the idea
 func (cn *conn) queryRow(query string, args ...interface{}) (err error) {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
 	st, err := cn.cn.executeDirect(query)
 	if err != nil {
 		return
 	}
 	defer st.free()
 	if ok := st.fetchNext(); !ok {
+		if err = cn.fetchError(); err != nil {
+			return
+		}
 		return io.EOF
 	}
 	if numcols := st.numCols(); numcols > 0 {
@@ -140,138 +595,1072 @@ func (cn *conn) queryRow(query string, args ...interface{}) (err error) {
 	return
 }
 
-// optional Execer interface for one-shot queries
-// TODO(ap): to be able to implement this correctly, I need to differentiate
-// between queries that do not return a resultset (as executeImmediately expects)
-// No other way to do that (to still be able to fallback to default behaviour)
-// than checking if a query is a `DELETE` or `UPDATE` for instance - meaah
-/*
-func (cn *conn) Exec(query string, args []driver.Value) (driver.Result, error) {
-	if len(args) == 0 {
-		err := cn.cn.executeImmediate(query)
-		if err != nil {
-			return nil, err
+// UseDatabase switches the connection to another database running on
+// the same server. SQL Anywhere connections are bound to a single
+// database so the connection is re-established with the database name
+// (`DBN`) replaced. Switching is refused within a transaction.
+// Statements prepared before the switch can not be used afterwards.
+// The connection is left intact if the new database can't be connected
+// to.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) UseDatabase(name string) error {
+	if !cn.autocommit {
+		return errors.New("sqla: cannot switch databases within a transaction")
+	}
+	cfg := *cn.cfg
+	cfg.Params = nil
+	for _, p := range cn.cfg.Params {
+		switch strings.ToLower(p.Name) {
+		case "dbn", "databasename", "dbf", "databasefile":
+			// the database is selected by name only
+		default:
+			cfg.Params = append(cfg.Params, p)
 		}
-		return &result{}, nil
 	}
-	// return ErrSkip to run the default implementation
-	return nil, driver.ErrSkip
-}
-*/
+	cfg.Params = append(cfg.Params, Param{Name: "DBN", Value: name})
+	nc, err := open(context.Background(), &cfg, nil)
+	if err != nil {
+		if nc != nil {
+			nc.Close()
+		}
+		return err
+	}
 
-// Tx
-func (t *tx) Commit() error {
-	if ret := t.cn.cn.commit(); !ret {
-		return t.cn.cn.newError()
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	if cn.events != nil {
+		cn.events.close()
+		cn.events = nil
+	}
+	if cn.stmts != nil {
+		cn.stmts.clear()
+	}
+	if !cn.cn.disconnect() {
+		cn.cfg.logger().Print("sqla: error disconnecting")
 	}
+	cn.cn.free()
+	cn.cn, cn.cfg, cn.charset = nc.cn, nc.cfg, nc.charset
+	cn.connected = true
+	cn.warnedNational = false
+	cn.generation++
+	// the metadata of the other connections is of another database
+	cn.meta = nil
 	return nil
 }
 
-func (t *tx) Rollback() error {
-	if ret := t.cn.cn.rollback(); !ret {
-		return t.cn.cn.newError()
+// ResetSession implements driver.SessionResetter.
+// database/sql calls it before reusing a pooled connection - a
+// connection which has been closed is discarded from the pool along with
+// its cached statements.
+// The statistics reported by Stats are reset as well.
+func (cn *conn) ResetSession(ctx context.Context) error {
+	if !cn.connected || cn.t != nil {
+		// a transaction left open (such as after a failed rollback)
+		// would take in everything run on the connection
+		return driver.ErrBadConn
 	}
+	cn.stats = ConnStats{}
 	return nil
 }
 
-type result struct {
-	st          *stmt
-	numaffected int64
+// ConnStats are the statistics of a connection (see Stats)
+type ConnStats struct {
+	Queries     int64 // statements executed
+	RowsFetched int64
+	// bytes sent to and received from the server over the lifetime of
+	// the connection (as reported by the server, not reset)
+	BytesSent     int64
+	BytesReceived int64
 }
 
-func (res *result) RowsAffected() (int64, error) {
-	return res.numaffected, nil
+// Stats returns the statistics of the connection accumulated since it
+// was last taken from the database/sql pool (see ResetSession).
+// The byte counts are queried from the server.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) Stats() (ConnStats, error) {
+	stats := cn.stats
+	// the server's view of the connection
+	var received, sent string
+	if err := cn.queryRow("select connection_property('BytesReceived'), connection_property('BytesSent')",
+		&received, &sent); err != nil {
+		return stats, err
+	}
+	stats.BytesSent, _ = strconv.ParseInt(received, 10, 64)
+	stats.BytesReceived, _ = strconv.ParseInt(sent, 10, 64)
+	return stats, nil
 }
 
-func (res *result) LastInsertId() (int64, error) {
-	if res.st != nil {
-		var id uint64
-		if err := res.st.cn.queryRow("select @@identity", &id); err != nil {
-			return 0, err
+// Ping implements driver.Pinger with a cheap round-trip to the server.
+// A ping which has not completed by the time ctx is done is canceled on
+// the server and reports the context error - the connection is still
+// usable (unlike driver.ErrBadConn which makes the pool discard it).
+func (cn *conn) Ping(ctx context.Context) error {
+	if err := cn.CheckConnection(ctx); err != nil {
+		if ctxerr := ctx.Err(); ctxerr != nil {
+			return ctxerr
 		}
-		return int64(id), nil
+		return driver.ErrBadConn
 	}
-	return 0, ErrNotSupported
+	return nil
 }
 
-type stmt struct {
-	cn        *conn
-	st        sqlaStmt
-	query     string
-	cols      []string
-	numparams int
-	closed    bool
-}
+// the round-trip of Ping and CheckConnection, overridden in tests
+var pingQuery = "select connection_property('Name')"
 
-// Statements
-//
-func (st *stmt) Close() error {
-	if st.closed {
-		log.Print("stmt.Close: invoked on an already closed stmt")
-		return nil
+// CheckConnection probes the connection with a round-trip to the server
+// and reports the error if it's unusable. Use ctx to bound the time the
+// check may take.
+// Unlike Ping, which is meant for the pool, the error is not translated
+// to driver.ErrBadConn.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) CheckConnection(ctx context.Context) error {
+	if !cn.connected {
+		return driver.ErrBadConn
 	}
-	if st.st.numCols() > 0 {
-		st.st.reset()
-		/* if isAutoCommit {
-		    _ = st.cn.cn.commit()   // ignore the result
-		} */
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer cn.watchCancel(ctx)()
+	var name string
+	if err := cn.queryRow(pingQuery, &name); err != nil {
+		return cn.ctxErr(ctx, err)
 	}
-	st.st.free()
-	st.closed = true
 	return nil
 }
 
-func (st *stmt) execute(args []driver.Value) (err error) {
-	if st.st.numCols() > 0 {
-		// auto-commit if configured
-		st.st.reset()
+// Scalar runs the query and returns the first column of the first row
+// or sql.ErrNoRows if the query produced no rows.
+// The query is canceled on the server once ctx is done.
+//
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection (see sql.Conn.Raw).
+func (cn *conn) Scalar(ctx context.Context, query string, args ...interface{}) (driver.Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	if args != nil {
-		if len(args) != st.numparams {
-			return fmt.Errorf("Number of arguments do not match that of bind params provided (%d != %d)",
-				len(args), st.numparams)
+	defer cn.watchCancel(ctx)()
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		vals[i] = arg
+	}
+	_, row, err := cn.queryFirst(query, vals)
+	if err != nil {
+		if err == io.EOF {
+			return nil, sql.ErrNoRows
 		}
-		for i := 0; i < st.numparams; i++ {
-			st.bindParam(uint(i), args[i])
+		return nil, cn.ctxErr(ctx, err)
+	}
+	return row[0], nil
+}
+
+// Describe prepares the query to report its parameters and result set
+// columns without executing it (for tooling such as query builders).
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) Describe(query string) (StmtInfo, error) {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	h, err := cn.cn.prepare(query)
+	if err != nil {
+		if e, ok := err.(*sqlaError); ok {
+			e.locate(query)
 		}
+		return StmtInfo{}, err
 	}
-	if ok := st.st.execute(); !ok {
-		err = st.cn.cn.newError()
-		return
+	defer h.free()
+	var info StmtInfo
+	st := &stmt{st: h, cn: cn, query: query}
+	if _, info.Columns, err = st.describeColumns(); err != nil {
+		return StmtInfo{}, err
 	}
-	return nil
+	for i := 0; i < h.numParams(); i++ {
+		bp := &bindParam{}
+		if ok := h.describeBindParam(sacapi_u32(i), bp); !ok {
+			return StmtInfo{}, cn.cn.newError()
+		}
+		info.Params = append(info.Params, bp.meta())
+	}
+	return info, nil
 }
 
-func (st *stmt) bindParam(index uint, param interface{}) (err error) {
-	bp := &bindParam{}
-	idx := sacapi_u32(index)
-	if ok := st.st.describeBindParam(idx, bp); !ok {
-		err = st.cn.cn.newError()
-		return
+// ServerTime returns the current time of the server (such as to align
+// expiry times computed by clients with the server clock).
+// The server's CURRENT UTC TIMESTAMP is read so the time is the same
+// instant regardless of the time zone of the server and is returned in
+// UTC like other TIMESTAMP values.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) ServerTime() (time.Time, error) {
+	v, err := cn.Scalar(context.Background(), "SELECT CURRENT UTC TIMESTAMP")
+	if err != nil {
+		return time.Time{}, err
 	}
-	// FIXME(ap): handle param being nil
-	isnull := param == nil
-	bp.value.isnull = &isnull
-	datasize := reflect.TypeOf(param).Size()
-	// initial approximation
-	bp.value.buffersize = datasize
-	bp.value.length = &datasize
-	v := reflect.ValueOf(param)
-	switch v.Kind() {
-	case reflect.Bool:
-		var b [1]byte
-		if v.Bool() {
-			b[0] = 1
-		} else {
-			b[0] = 0
+	t, ok := v.(time.Time)
+	if !ok {
+		// TIMESTAMP_FORMAT has been changed
+		return time.Time{}, fmt.Errorf("sqla: unexpected server time %v", v)
+	}
+	// read in Config.Location
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC), nil
+}
+
+// QueryColumnar runs the query and returns all its rows grouped by
+// column rather than by row: data[i][j] is the value of the column
+// columns[i] in row j. Scanning a column at a time is friendlier to the
+// CPU caches for aggregations over large results.
+// The values are of the same types as the ones returned for rows.
+// The query is canceled on the server once ctx is done.
+//
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection (see sql.Conn.Raw).
+func (cn *conn) QueryColumnar(ctx context.Context, query string, args ...interface{}) (columns []string, data [][]driver.Value, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	defer cn.watchCancel(ctx)()
+	s, err := cn.Prepare(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	st := s.(*stmt)
+	defer st.Close()
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		vals[i] = arg
+	}
+	if err = st.execute(vals); err != nil {
+		return nil, nil, cn.ctxErr(ctx, err)
+	}
+	rs := newRows(st)
+	columns = rs.Columns()
+	data = make([][]driver.Value, len(columns))
+	row := make([]driver.Value, len(columns))
+	for {
+		if err = rs.Next(row); err != nil {
+			if err == io.EOF {
+				return columns, data, nil
+			}
+			return nil, nil, cn.ctxErr(ctx, err)
 		}
-		bp.value.buffer = &b[0]
+		for i, v := range row {
+			if b, ok := v.([]byte); ok {
+				// aliases the fetch buffer
+				v = append([]byte(nil), b...)
+			}
+			data[i] = append(data[i], v)
+		}
+	}
+}
+
+// QueryStream runs the query and sends its rows over the first channel
+// as they are fetched, e.g.
+//
+//	rows, errc := cn.QueryStream(ctx, "select id, name from items")
+//	for row := range rows {
+//		...
+//	}
+//	if err := <-errc; err != nil {
+//		...
+//	}
+//
+// Rows are only fetched as fast as they are received so a slow consumer
+// holds back the query rather than having the rows pile up in memory.
+// The rows channel is closed once the query is done and the error
+// channel then receives the outcome: nil if all rows have been sent.
+// Once ctx is done the query is canceled on the server and no more rows
+// are sent. The connection must not be used for anything else until the
+// error has been received.
+// The values are of the same types as the ones returned for rows.
+//
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection (see sql.Conn.Raw).
+func (cn *conn) QueryStream(ctx context.Context, query string, args ...interface{}) (<-chan []driver.Value, <-chan error) {
+	rows := make(chan []driver.Value)
+	errc := make(chan error, 1)
+	go func() {
+		err := cn.stream(ctx, query, args, rows)
+		close(rows)
+		errc <- err
+		close(errc)
+	}()
+	return rows, errc
+}
+
+// Sends the rows of the query to out (see QueryStream)
+func (cn *conn) stream(ctx context.Context, query string, args []interface{}, out chan<- []driver.Value) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer cn.watchCancel(ctx)()
+	s, err := cn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	st := s.(*stmt)
+	defer st.Close()
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		vals[i] = arg
+	}
+	if err = st.execute(vals); err != nil {
+		return cn.ctxErr(ctx, err)
+	}
+	rs := newRows(st)
+	numcols := len(rs.Columns())
+	for {
+		row := make([]driver.Value, numcols)
+		if err = rs.Next(row); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return cn.ctxErr(ctx, err)
+		}
+		for i, v := range row {
+			if b, ok := v.([]byte); ok {
+				// aliases the fetch buffer
+				row[i] = append([]byte(nil), b...)
+			}
+		}
+		// checked first as select picks a ready case at random - a
+		// waiting consumer would still receive rows after ctx is done
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		select {
+		case out <- row:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// UpdateLOB overwrites len(data) bytes of the LONG BINARY (or LONG
+// VARCHAR) value of column in the row of table identified by rowid,
+// starting at offset (0-based), e.g.
+//
+//	err := cn.UpdateLOB(ctx, "documents", "body", id, 1<<20, patch)
+//
+// The C API has no partial update of values (such as WRITETEXT) - the
+// value is spliced on the server so that only data is transferred rather
+// than the whole value. The server still rewrites the whole value (it is
+// rebuilt from the parts before and after data) so the update costs as
+// much on the server as writing the value anew. The value is extended if
+// data reaches past its end. Fails if there's no such row or the value
+// is NULL or shorter than offset. Table and column names are quoted - a
+// table name with a dot is taken as owner.table.
+// The update is canceled on the server once ctx is done.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) UpdateLOB(ctx context.Context, table, column string, rowid RowID, offset int64, data []byte) error {
+	if offset < 0 {
+		return fmt.Errorf("sqla: invalid offset %d", offset)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tbl, col := quoteQualified(table), QuoteIdentifier(column)
+	s, err := cn.Prepare(fmt.Sprintf("UPDATE %[1]s AS t SET %[2]s = BYTE_SUBSTR(%[2]s, 1, ?) || ? || BYTE_SUBSTR(%[2]s, ?) "+
+		"WHERE ROWID(t) = ? AND BYTE_LENGTH(%[2]s) >= ?", tbl, col))
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	st := s.(*stmt)
+	defer cn.watchCancel(ctx)()
+	if data == nil {
+		data = []byte{}
+	}
+	end := offset + int64(len(data)) + 1
+	if err = st.execute([]driver.Value{offset, data, end, uint64(rowid), offset}); err != nil {
+		return cn.ctxErr(ctx, err)
+	}
+	if st.st.affectedRows() < 1 {
+		return fmt.Errorf("sqla: no row %d in %s with a %s value of at least %d bytes", rowid, table, column, offset)
+	}
+	return nil
+}
+
+// Explain returns the plan the optimizer chooses for the query (as
+// reported by the EXPLANATION function) for performance debugging.
+// The arguments are inlined into the query as literals - the query is
+// not executed.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) Explain(ctx context.Context, query string, args ...interface{}) (string, error) {
+	inlined, err := inlineArgs(query, args, cn.cfg)
+	if err != nil {
+		return "", err
+	}
+	v, err := cn.Scalar(ctx, "SELECT EXPLANATION(?)", inlined)
+	if err != nil {
+		return "", err
+	}
+	plan, _ := v.(string)
+	return plan, nil
+}
+
+// ExecScript executes the statements of a script (such as a migration)
+// one by one. Statements are separated with `;` or lines consisting of
+// `go` - separators within string literals, comments and BEGIN ... END
+// blocks are ignored.
+// Execution stops at the first failing statement which is reported with
+// a *ScriptError.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver connection.
+func (cn *conn) ExecScript(ctx context.Context, script string) error {
+	defer cn.watchCancel(ctx)()
+	for i, query := range splitScript(script) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := cn.checkReadOnly(query); err != nil {
+			return &ScriptError{Index: i, Statement: query, Err: err}
+		}
+		if err := cn.cn.executeImmediate(query); err != nil {
+			return &ScriptError{Index: i, Statement: query, Err: cn.ctxErr(ctx, err)}
+		}
+		cn.stats.Queries++
+	}
+	return nil
+}
+
+// Runs the query and fetches the first row of the result set.
+// Returns io.EOF if there are no rows - a failed fetch is reported
+// with the server error instead.
+func (cn *conn) queryFirst(query string, args []driver.Value) (cols []string, row []driver.Value, err error) {
+	s, err := cn.Prepare(query)
+	if err != nil {
+		return
+	}
+	st := s.(*stmt)
+	defer st.Close()
+	if err = st.describe(); err != nil {
+		return
+	}
+	if len(st.cols) == 0 {
+		err = errors.New("sqla: query does not return a result set")
+		return
+	}
+	if err = st.execute(args); err != nil {
+		return
+	}
+	row = make([]driver.Value, len(st.cols))
+	if err = newRows(st).Next(row); err != nil {
+		return
+	}
+	return st.cols, row, nil
+}
+
+// Cancels the operation running on the connection once ctx is done.
+// The returned function has to be called when the operation completes -
+// it waits for a cancel under way so that the cancel can not hit the next
+// operation on the connection.
+func (cn *conn) watchCancel(ctx context.Context) (stop func()) {
+	if ctx.Done() == nil || !capabilities.Cancel {
+		return func() {}
+	}
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			cn.cn.cancel()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		// the cancel must not hit the next operation on the connection
+		<-exited
+	}
+}
+
+// Reports the context error instead of err if the operation failed
+// because it has been canceled
+func (cn *conn) ctxErr(ctx context.Context, err error) error {
+	if ctxerr := ctx.Err(); ctxerr != nil {
+		return ctxerr
+	}
+	return err
+}
+
+// optional Execer interface for one-shot queries
+// TODO(ap): to be able to implement this correctly, I need to differentiate
+// between queries that do not return a resultset (as executeImmediately expects)
+// No other way to do that (to still be able to fallback to default behaviour)
+// than checking if a query is a `DELETE` or `UPDATE` for instance - meaah
+/*
+func (cn *conn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	if len(args) == 0 {
+		err := cn.cn.executeImmediate(query)
+		if err != nil {
+			return nil, err
+		}
+		return &result{}, nil
+	}
+	// return ErrSkip to run the default implementation
+	return nil, driver.ErrSkip
+}
+*/
+
+// Tx
+// A failed commit rolls the transaction back - database/sql considers
+// the transaction done once Commit has been called so it could not be
+// rolled back later
+func (t *tx) Commit() error {
+	t.cn.mu.Lock()
+	defer t.cn.mu.Unlock()
+	if err := t.active(); err != nil {
+		return err
+	}
+	if ret := t.cn.cn.commit(); !ret {
+		err := t.cn.cn.newError()
+		if !t.cn.cn.rollback() {
+			t.cn.cfg.logger().Print("sqla: failed to roll back after a failed commit: ", t.cn.cn.newError())
+		}
+		t.end()
+		return err
+	}
+	t.end()
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	t.cn.mu.Lock()
+	defer t.cn.mu.Unlock()
+	if err := t.active(); err != nil {
+		return err
+	}
+	if ret := t.cn.cn.rollback(); !ret {
+		return t.cn.cn.newError()
+	}
+	t.end()
+	return nil
+}
+
+func (t *tx) active() error {
+	if t.cn.t != t {
+		return errors.New("sqla: transaction has already been committed or rolled back")
+	}
+	return nil
+}
+
+// Switches the connection back to autocommit mode (and the default
+// isolation level) once the transaction has been committed or rolled
+// back
+func (t *tx) end() {
+	t.cn.t = nil
+	t.cn.autocommit = true
+	if t.isolation {
+		t.cn.restoreIsolation()
+	}
+}
+
+type result struct {
+	st          *stmt
+	numaffected int64
+	// false if the statement does not report a count (such as DDL)
+	hasaffected bool
+	warnings    []Warning
+}
+
+// RowsAffected reports the number of rows the statement itself has
+// inserted, updated or deleted. Rows changed by referential actions
+// (such as ON DELETE CASCADE) or triggers are not included.
+// Returns ErrNoRowsAffected for statements which do not report a count
+// (DDL statements or if the server could not provide one) rather than
+// a misleading 0.
+func (res *result) RowsAffected() (int64, error) {
+	if !res.hasaffected {
+		return 0, ErrNoRowsAffected
+	}
+	return res.numaffected, nil
+}
+
+// Warnings returns the warnings the server reported for the statement.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver result.
+func (res *result) Warnings() []Warning {
+	return res.warnings
+}
+
+// LastInsertId returns the last value generated for an identity column
+// on the connection as reported by the identity query (see
+// Config.IdentityQuery). Returns ErrNotSupported if the query fails or
+// returns no value (NULL or no row) rather than the native error.
+func (res *result) LastInsertId() (int64, error) {
+	if res.st == nil {
+		return 0, ErrNotSupported
+	}
+	cn := res.st.cn
+	_, row, err := cn.queryFirst(cn.cfg.identityQuery(), nil)
+	if err != nil {
+		if errors.Is(err, ErrConnLost) {
+			return 0, err
+		}
+		return 0, ErrNotSupported
+	}
+	switch id := row[0].(type) {
+	case int64:
+		return id, nil
+	case int32:
+		return int64(id), nil
+	case uint64:
+		return int64(id), nil
+	case uint32:
+		return int64(id), nil
+	case string:
+		// NUMERIC
+		if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, ErrNotSupported
+}
+
+type stmt struct {
+	cn        *conn
+	st        sqlaStmt
+	query     string
+	cols      []string
+	meta      []ColumnMeta // cached result set column metadata
+	numparams int
+	closed    bool
+	// cols and meta are valid (see describe)
+	described  bool
+	describeMu sync.Mutex
+	// the cursor can only move forward
+	forwardOnly bool
+	// executed and the cursor (if any) not closed yet
+	executed bool
+	// of the connection the statement has been prepared on
+	generation int
+	// bind parameters of the last execution - the native side keeps
+	// pointers into these so they must stay reachable until the statement
+	// is executed again or freed
+	binds []*bindParam
+	// when binds were bound (only tracked with Config.DebugBindBuffers)
+	bound time.Time
+	// parameter values to be sent in chunks with sqlany_send_param_data
+	chunked []chunkedParam
+	// output parameters awaiting delivery
+	outs []outParam
+}
+
+// output parameter
+type outParam struct {
+	value *dataValue
+	dest  interface{} // pointer to assign the value to
+}
+
+// size of the buffer receiving string/binary output parameters -
+// longer values are truncated
+const outParamBufferSize = 32 << 10
+
+// parameter value too large to be bound inline
+type chunkedParam struct {
+	index sacapi_u32
+	data  []byte
+}
+
+// InsertedRow fetches the row the statement (an INSERT into a table with
+// an autoincrement column) has just inserted, including the values
+// generated by the server such as defaults.
+// It costs two additional round-trips: one to look up the autoincrement
+// column in the catalog and one to select the row by its @@identity -
+// local temporary tables are not in the catalog and are not supported.
+// It needs to be accessed with a type assertion on the driver statement.
+func (st *stmt) InsertedRow() (map[string]driver.Value, error) {
+	m := insertTableRe.FindStringSubmatch(st.query)
+	if m == nil {
+		return nil, errors.New("sqla: not an INSERT statement")
+	}
+	table := m[1]
+	name := table
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	_, row, err := st.cn.queryFirst(`select column_name from sys.syscolumn c
+		join sys.systable t on c.table_id = t.table_id
+		where t.table_name = ? and c."default" = 'autoincrement'`, []driver.Value{strings.Trim(name, `"[]`)})
+	if err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("sqla: no autoincrement column in %s", table)
+		}
+		return nil, err
+	}
+	idcol, _ := row[0].(string)
+	cols, row, err := st.cn.queryFirst(fmt.Sprintf("select * from %s where %s = @@identity",
+		table, QuoteIdentifier(idcol)), nil)
+	if err != nil {
+		if err == io.EOF {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	values := make(map[string]driver.Value, len(cols))
+	for i, col := range cols {
+		values[col] = row[i]
+	}
+	return values, nil
+}
+
+var insertTableRe = regexp.MustCompile(`(?is)^\s*insert\s+(?:into\s+)?([^\s(]+)`)
+
+// queries which open a cursor
+var selectRe = regexp.MustCompile(`(?is)^\s*(?:select|with)\b`)
+
+// statements w/o a meaningful affected rows count
+var ddlRe = regexp.MustCompile(`(?is)^\s*(?:create|alter|drop|grant|revoke|comment)\b`)
+
+// Rejects statements other than queries on read-only connections
+func (cn *conn) checkReadOnly(query string) error {
+	if cn.cfg.ReadOnly && !selectRe.MatchString(query) {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// Statements
+//
+func (st *stmt) Close() error {
+	if st.closed {
+		st.cn.cfg.logger().Print("stmt.Close: invoked on an already closed stmt")
+		return nil
+	}
+	st.cn.mu.Lock()
+	evicted := st.close()
+	st.cn.mu.Unlock()
+	// outside of the connection lock so that the callback may use the
+	// connection (pool) without deadlocking
+	if onEvict := st.cn.cfg.OnStmtEvict; onEvict != nil {
+		for _, query := range evicted {
+			onEvict(query)
+		}
+	}
+	return nil
+}
+
+// Frees the statement or returns it to the statement cache.
+// Returns the queries of the statements evicted from the cache to make
+// room for it.
+func (st *stmt) close() (evicted []string) {
+	st.closed = true
+	if st.generation != st.cn.generation {
+		// freed along with the native connection it was prepared on
+		return nil
+	}
+	st.closeCursor()
+	st.ResetParams()
+	if st.cn.stmts != nil && st.cn.connected {
+		// keep the handle prepared for the next Prepare of the query
+		return st.cn.stmts.put(st)
+	}
+	st.st.free()
+	return nil
+}
+
+// Statements are prepared on the connection rather than within a
+// transaction: a statement prepared before Begin can be executed within
+// the transaction and remains usable after Commit/Rollback (which close
+// its open cursors). Statements can't be used once closed or after the
+// connection switched databases.
+func (st *stmt) usable() error {
+	if st.closed {
+		return errStmtClosed
+	}
+	if st.generation != st.cn.generation {
+		return errors.New("sqla: statement was prepared before switching databases")
+	}
+	return nil
+}
+
+var errStmtClosed = errors.New("sqla: statement is closed")
+
+// Closes the cursor of a statement producing a result set.
+// In autocommit mode this also commits so that the locks held by the
+// cursor are released - inside a transaction it is up to the caller.
+// Does nothing if the cursor has already been closed (rows.Close
+// followed by stmt.Close).
+func (st *stmt) closeCursor() {
+	if !st.executed {
+		return
+	}
+	st.executed = false
+	if st.st.numCols() > 0 {
+		st.st.reset()
+		if st.cn.autocommit {
+			_ = st.cn.cn.commit() // ignore the result
+		}
+	}
+}
+
+// Error of a failed fetch or nil if the cursor simply moved past
+// the end of the result set
+func (st *stmt) fetchError() error {
+	return st.cn.fetchError()
+}
+
+// Runs a fetch of the cursor (such as fetchNext) which is canceled once
+// Config.FetchTimeout has passed. Reports whether a row has been
+// fetched and the error if the fetch failed (ErrFetchTimeout if it has
+// been canceled).
+func (st *stmt) fetch(f func() bool) (bool, error) {
+	timeout := st.cn.cfg.FetchTimeout
+	if timeout <= 0 || !capabilities.Cancel {
+		if f() {
+			return true, nil
+		}
+		return false, st.fetchError()
+	}
+	fired := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() {
+		st.cn.cn.cancel()
+		close(fired)
+	})
+	ok := f()
+	if timer.Stop() {
+		if ok {
+			return true, nil
+		}
+		return false, st.fetchError()
+	}
+	// the cancel must not hit the next operation on the connection
+	<-fired
+	if ok {
+		// fetched just in time
+		return true, nil
+	}
+	if err := st.fetchError(); err != nil {
+		return false, ErrFetchTimeout
+	}
+	return false, nil
+}
+
+func (cn *conn) fetchError() error {
+	err := cn.cn.newError()
+	// check if the result set has really been exhausted
+	if err != nil && err.(*sqlaError).code != sqlcodeNotFound {
+		return err
+	}
+	return nil
+}
+
+func (st *stmt) execute(args []driver.Value) (err error) {
+	if err = st.usable(); err != nil {
+		return
+	}
+	if st.st.numCols() > 0 {
+		// auto-commit if configured
+		st.st.reset()
+	}
+	if args == nil && st.numparams > 0 && len(st.binds) == 0 {
+		// the native side may still refer to the released buffers
+		return errParamsReset
+	}
+	if args != nil {
+		args = flattenArgs(args)
+		if len(args) != st.numparams {
+			return fmt.Errorf("Number of arguments do not match that of bind params provided (%d != %d)",
+				len(args), st.numparams)
+		}
+		st.ResetParams()
+		for i := 0; i < st.numparams; i++ {
+			if err = st.bindParam(uint(i), args[i]); err != nil {
+				return
+			}
+		}
+		if err = st.sendChunked(); err != nil {
+			return
+		}
+	}
+	if ok := st.st.execute(); !ok {
+		err = st.cn.cn.newError()
+		return
+	}
+	st.executed = true
+	st.cn.stats.Queries++
+	return nil
+}
+
+// Replaces the []interface{} arguments with their elements which are
+// bound to consecutive placeholders, e.g. []interface{}{1, "a", 2.5}
+// binds the three placeholders of VALUES (?, ?, ?) - each element as
+// per its own type.
+func flattenArgs(args []driver.Value) []driver.Value {
+	n, nested := 0, false
+	for _, arg := range args {
+		if vals, ok := arg.([]interface{}); ok {
+			n += len(vals)
+			nested = true
+		} else {
+			n++
+		}
+	}
+	if !nested {
+		return args
+	}
+	flat := make([]driver.Value, 0, n)
+	for _, arg := range args {
+		if vals, ok := arg.([]interface{}); ok {
+			for _, v := range vals {
+				flat = append(flat, v)
+			}
+		} else {
+			flat = append(flat, arg)
+		}
+	}
+	return flat
+}
+
+func (st *stmt) bindParam(index uint, param interface{}) (err error) {
+	bp := &bindParam{}
+	idx := sacapi_u32(index)
+	if ok := st.st.describeBindParam(idx, bp); !ok {
+		err = st.cn.cn.newError()
+		return
+	}
+	switch p := param.(type) {
+	case sql.Out:
+		err = st.setOutValue(idx, bp, p)
+	case TypedValue:
+		err = st.setTypedValue(idx, bp, p)
+	default:
+		err = st.setValue(idx, bp, param)
+	}
+	if err != nil {
+		return
+	}
+	if ok := st.st.bindParam(idx, bp); !ok {
+		err = st.cn.cn.newError()
+		return
+	}
+	st.binds = append(st.binds, bp)
+	if st.cn.cfg.DebugBindBuffers {
+		st.bound = time.Now()
+		st.cn.cfg.logger().Print(fmt.Sprintf("sqla: bind buffer %d: %d bytes at %p (type %d)",
+			index, bp.value.buffersize, bp.value.buffer, bp.value.datatype))
+	}
+
+	return nil
+}
+
+var errParamsReset = errors.New("sqla: statement parameters have been reset and need to be bound again")
+
+// ResetParams drops the parameter values bound by the last execution of
+// the statement (including the buffers of output parameters and of
+// values sent in chunks) so that they can be garbage collected and
+// nothing of them is carried over into the next execution.
+// Executing the statement binds all of its parameters anew and resets
+// them implicitly - the statement can not be executed again without
+// arguments once they have been reset.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver statement.
+func (st *stmt) ResetParams() {
+	st.releaseBinds()
+	for i := range st.chunked {
+		st.chunked[i] = chunkedParam{}
+	}
+	st.chunked = st.chunked[:0]
+	for i := range st.outs {
+		st.outs[i] = outParam{}
+	}
+	st.outs = st.outs[:0]
+}
+
+// Drops the bind parameters of the last execution once the native side
+// no longer refers to them
+func (st *stmt) releaseBinds() {
+	if st.cn.cfg.DebugBindBuffers {
+		lifetime := time.Since(st.bound)
+		for i, bp := range st.binds {
+			st.cn.cfg.logger().Print(fmt.Sprintf("sqla: bind buffer %d: %d bytes at %p released after %s",
+				i, bp.value.buffersize, bp.value.buffer, lifetime))
+		}
+	}
+	for i := range st.binds {
+		st.binds[i] = nil
+	}
+	st.binds = st.binds[:0]
+}
+
+// Fills in the value of the bind parameter
+func (st *stmt) setValue(idx sacapi_u32, bp *bindParam, param interface{}) (err error) {
+	// values not converted by database/sql (i.e. passed through
+	// the driver directly) are given a chance to convert themselves
+	if param, err = bindable(param); err != nil {
+		return
+	}
+	switch p := param.(type) {
+	case []rune:
+		// passed to the driver directly - bound as UTF-8 text
+		param = string(p)
+	case json.Number:
+		// a string type - bound as a number rather than as text
+		if param, err = jsonNumber(p); err != nil {
+			return
+		}
+	case time.Time:
+		if p.IsZero() && st.cn.cfg.ZeroTimeAsNull {
+			param = nil
+			break
+		}
+		// the server converts the string to the type of the target -
+		// describeBindParam only reports A_STRING for temporal types
+		// (not the actual DATE/TIME/TIMESTAMP) and for DATE targets
+		// the time of day is simply dropped by the conversion, so the
+		// value is taken to Location first for the date to be the one
+		// in Location
+		if dt := bp.value.datatype; dt != A_STRING && dt != A_INVALID_TYPE {
+			return fmt.Errorf("sqla: cannot bind time.Time to a parameter of type %d", dt)
+		}
+		param = p.In(st.cn.cfg.location()).Format(st.cn.cfg.timestampFormat())
+	}
+	var isnull sacapi_bool
+	bp.value.isnull = &isnull
+	if param == nil {
+		// keep the data type suggested by the server
+		var size uintptr
+		isnull = 1
+		bp.value.buffer = nil
+		bp.value.buffersize = 0
+		bp.value.length = &size
+		return nil
+	}
+	datasize := reflect.TypeOf(param).Size()
+	// initial approximation
+	bp.value.buffersize = datasize
+	bp.value.length = &datasize
+	v := reflect.ValueOf(param)
+	switch v.Kind() {
+	case reflect.Bool:
+		var b [1]byte
+		if v.Bool() {
+			b[0] = 1
+		} else {
+			b[0] = 0
+		}
+		bp.value.buffer = &b[0]
 		bp.value.datatype = A_UVAL8
-	case reflect.Int64:
+	case reflect.Int64, reflect.Int:
+		if bp.value.datatype == A_STRING {
+			// DECIMAL/NUMERIC targets are described as A_STRING - the
+			// digits are bound instead so the server parses the value
+			// exactly rather than converting from a 64-bit integer
+			st.setString(idx, bp, strconv.FormatInt(v.Int(), 10))
+			break
+		}
+		// int (passed to the driver directly by LoadTable, ExecBatch
+		// and the like) keeps its full range
 		i := v.Int()
+		datasize = 8 // int is narrower on 32bit
 		bp.value.buffer = (*byte)(unsafe.Pointer(&i))
+		bp.value.buffersize = datasize
 		bp.value.datatype = A_VAL64
-	case reflect.Int32, reflect.Int:
+	case reflect.Int32:
 		i := int32(v.Int())
 		bp.value.buffer = (*byte)(unsafe.Pointer(&i))
 		bp.value.datatype = A_VAL32
@@ -283,91 +1672,846 @@ func (st *stmt) bindParam(index uint, param interface{}) (err error) {
 		i := int8(v.Int())
 		bp.value.buffer = (*byte)(unsafe.Pointer(&i))
 		bp.value.datatype = A_VAL8
-	case reflect.Float32, reflect.Float64:
+	case reflect.Uint64, reflect.Uint:
+		if bp.value.datatype == A_STRING {
+			// DECIMAL/NUMERIC target (see reflect.Int64)
+			st.setString(idx, bp, strconv.FormatUint(v.Uint(), 10))
+			break
+		}
+		// the full unsigned range, UNSIGNED BIGINT in particular
+		u := v.Uint()
+		datasize = 8 // uint is narrower on 32bit
+		bp.value.buffer = (*byte)(unsafe.Pointer(&u))
+		bp.value.buffersize = datasize
+		bp.value.datatype = A_UVAL64
+	case reflect.Uint32:
+		u := uint32(v.Uint())
+		bp.value.buffer = (*byte)(unsafe.Pointer(&u))
+		bp.value.datatype = A_UVAL32
+	case reflect.Uint16:
+		u := uint16(v.Uint())
+		bp.value.buffer = (*byte)(unsafe.Pointer(&u))
+		bp.value.datatype = A_UVAL16
+	case reflect.Uint8:
+		u := uint8(v.Uint())
+		bp.value.buffer = &u
+		bp.value.datatype = A_UVAL8
+	case reflect.Float32:
+		if !capabilities.Float32 {
+			f := v.Float()
+			datasize = 8
+			bp.value.buffer = (*byte)(unsafe.Pointer(&f))
+			bp.value.buffersize = datasize
+			bp.value.datatype = A_DOUBLE
+			break
+		}
+		// bound as is so REAL columns receive the value w/o a round-trip
+		// through float64
+		f := float32(v.Float())
+		bp.value.buffer = (*byte)(unsafe.Pointer(&f))
+		bp.value.datatype = A_FLOAT
+	case reflect.Float64:
 		f := v.Float()
 		bp.value.buffer = (*byte)(unsafe.Pointer(&f))
 		bp.value.datatype = A_DOUBLE
 	case reflect.Complex64, reflect.Complex128:
 	case reflect.String:
-		bp.value.datatype = A_STRING
+		// includes named string types (such as enums) - types with a
+		// custom representation implement driver.Valuer
 		s := v.String()
-		b := syscall.StringBytePtr(s)
-		size := uintptr(len(s))
-		bp.value.buffer = b
-		bp.value.buffersize = size + 1 // account for null terminator
-		bp.value.length = &size
+		if st.cn.cfg.NormalizeUnicode {
+			s = norm.NFC.String(s)
+		}
+		st.setString(idx, bp, s)
 	case reflect.Slice:
 		if b, ok := v.Interface().([]byte); ok {
 			bp.value.datatype = A_BINARY
-			bp.value.buffer = &b[0]
+			if len(b) > st.cn.cfg.maxInlineParam() {
+				st.bindChunked(idx, bp, b)
+				break
+			}
 			size := uintptr(v.Len())
+			if size == 0 {
+				b = make([]byte, 1)
+			}
+			bp.value.buffer = &b[0]
 			bp.value.buffersize = size
 			bp.value.length = &size
 		}
 		// FIXME(ap): fallthrough for non-byte slices
 	default:
-		log.Println("sqla: unsupported type", v)
+		st.cn.cfg.logger().Print("sqla: unsupported type ", v)
 		return ErrNotSupported
 	}
-	if ok := st.st.bindParam(idx, bp); !ok {
-		err = st.cn.cn.newError()
+	return nil
+}
+
+// Resolves the value to bind: driver.Valuers bind their value and
+// pointers what they point to (NULL if nil)
+func bindable(param interface{}) (interface{}, error) {
+	for {
+		v := reflect.ValueOf(param)
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, nil
+		}
+		if valuer, ok := param.(driver.Valuer); ok {
+			return valuer.Value()
+		}
+		if v.Kind() != reflect.Ptr {
+			return param, nil
+		}
+		param = v.Elem().Interface()
+	}
+}
+
+func (st *stmt) setString(idx sacapi_u32, bp *bindParam, s string) {
+	bp.value.datatype = A_STRING
+	if len(s) > st.cn.cfg.maxInlineParam() {
+		st.bindChunked(idx, bp, []byte(s))
 		return
 	}
+	// the C API expects the length of A_STRING values in bytes, not
+	// characters - the connection character set is utf-8 so Go strings
+	// are passed on as is and the server does the conversion
+	size := uintptr(len(s))
+	b := make([]byte, size+1) // account for null terminator
+	copy(b, s)
+	bp.value.buffer = &b[0]
+	bp.value.buffersize = size + 1
+	bp.value.length = &size
+}
+
+// Binds the value as is with the given data type (see TypedValue)
+func (st *stmt) setTypedValue(idx sacapi_u32, bp *bindParam, v TypedValue) error {
+	dt := dataType(v.Datatype)
+	if dt <= A_INVALID_TYPE || dt > A_FLOAT {
+		return fmt.Errorf("sqla: invalid data type %d of parameter %d", v.Datatype, idx+1)
+	}
+	var isnull sacapi_bool
+	bp.value.isnull = &isnull
+	bp.value.datatype = dt
+	size := uintptr(len(v.Buffer))
+	bp.value.length = &size
+	switch {
+	case v.Buffer == nil:
+		isnull = 1
+		bp.value.buffer = nil
+		bp.value.buffersize = 0
+		return nil
+	case dt.fixedSize() > 0 && len(v.Buffer) != dt.fixedSize():
+		return fmt.Errorf("sqla: parameter %d of data type %d takes %d bytes, got %d",
+			idx+1, v.Datatype, dt.fixedSize(), len(v.Buffer))
+	case len(v.Buffer) > st.cn.cfg.maxInlineParam():
+		st.bindChunked(idx, bp, v.Buffer)
+		return nil
+	}
+	b := v.Buffer
+	if len(b) == 0 {
+		b = make([]byte, 1)
+	}
+	bp.value.buffer = &b[0]
+	bp.value.buffersize = size
+	return nil
+}
+
+// Binds an output (sql.Out.In is false) or input/output parameter.
+// The value is assigned to the destination once it's available (see
+// deliverOuts).
+func (st *stmt) setOutValue(idx sacapi_u32, bp *bindParam, out sql.Out) error {
+	dest := reflect.ValueOf(out.Dest)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return errors.New("sqla: sql.Out destination must be a non-nil pointer")
+	}
+	if out.In {
+		bp.dir = DD_INPUT_OUTPUT
+		if err := st.setValue(idx, bp, dest.Elem().Interface()); err != nil {
+			return err
+		}
+	} else {
+		// the data type is the one suggested by the server
+		var isnull sacapi_bool
+		var size uintptr
+		bp.dir = DD_OUTPUT
+		bp.value.isnull = &isnull
+		bp.value.buffer = nil
+		bp.value.buffersize = 0
+		bp.value.length = &size
+	}
+	// make room for the output value
+	size := uintptr(8)
+	if bp.value.datatype == A_STRING || bp.value.datatype == A_BINARY {
+		size = outParamBufferSize
+	}
+	if bp.value.buffersize < size {
+		b := make([]byte, size)
+		if bp.value.buffer != nil {
+			copy(b, (*[1 << 20]byte)(unsafe.Pointer(bp.value.buffer))[:bp.value.buffersize])
+		}
+		bp.value.buffer = &b[0]
+		bp.value.buffersize = size
+	}
+	st.outs = append(st.outs, outParam{value: &bp.value, dest: out.Dest})
+	return nil
+}
+
+// Assigns the values of the output parameters to their destinations.
+// The values are only valid once the statement has been executed and
+// all its result sets have been consumed.
+func (st *stmt) deliverOuts() error {
+	outs := st.outs
+	st.outs = st.outs[:0]
+	for _, out := range outs {
+		if err := assignOut(out.dest, out.value.Value()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Binds the parameter without a buffer - the value is sent separately
+// in chunks before the statement is executed
+func (st *stmt) bindChunked(index sacapi_u32, bp *bindParam, data []byte) {
+	var size uintptr
+	bp.value.buffer = nil
+	bp.value.buffersize = 0
+	bp.value.length = &size
+	st.chunked = append(st.chunked, chunkedParam{index: index, data: data})
+}
 
+func (st *stmt) sendChunked() error {
+	chunksize := st.cn.cfg.maxInlineParam()
+	for _, p := range st.chunked {
+		for data := p.data; len(data) > 0; {
+			n := len(data)
+			if n > chunksize {
+				n = chunksize
+			}
+			if ok := st.st.sendParamData(p.index, data[:n]); !ok {
+				return st.cn.cn.newError()
+			}
+			data = data[n:]
+		}
+	}
 	return nil
 }
 
+// context key of WithoutPrefetch
+type noPrefetchKey struct{}
+
+// WithoutPrefetch returns a context which disables prefetching for the
+// queries it is passed to (with QueryContext) so that their rows are
+// fetched one per round-trip, e.g. for queries with huge rows which
+// should not be buffered in bulk despite a connection-wide prefetch
+// setting (such as the PrefetchRows connection parameter).
+// The prefetch option is turned off for the connection while the rows
+// are open and restored once they are closed.
+func WithoutPrefetch(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noPrefetchKey{}, true)
+}
+
+// QueryContext implements driver.StmtQueryContext so that queries can
+// be run with WithoutPrefetch
+func (st *stmt) QueryContext(ctx context.Context, named []driver.NamedValue) (driver.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	args := make([]driver.Value, len(named))
+	for i, nv := range named {
+		if nv.Name != "" {
+			return nil, errors.New("sqla: named parameters are not supported")
+		}
+		args[i] = nv.Value
+	}
+	if ctx.Value(noPrefetchKey{}) == nil {
+		return st.Query(args)
+	}
+	var prefetch string
+	if err := st.cn.queryRow("select connection_property('prefetch')", &prefetch); err != nil {
+		return nil, err
+	}
+	if err := st.cn.cn.executeImmediate("SET TEMPORARY OPTION prefetch = 'Off'"); err != nil {
+		return nil, err
+	}
+	r, err := st.Query(args)
+	if err != nil {
+		st.cn.setPrefetch(prefetch)
+		return nil, err
+	}
+	rs := r.(*rows)
+	rs.prefetch = prefetch
+	return rs, nil
+}
+
+// Restores the prefetch option turned off for a query
+func (cn *conn) setPrefetch(value string) {
+	if err := cn.cn.executeImmediate("SET TEMPORARY OPTION prefetch = " + QuoteLiteral(value)); err != nil {
+		cn.cfg.logger().Print("sqla: failed to restore the prefetch option: ", err)
+	}
+}
+
 func (st *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	var start time.Time
+	if st.cn.cfg.SlowQueryThreshold > 0 {
+		start = time.Now()
+	}
 	if err := st.execute(args); err != nil {
-		return nil, err
+		return nil, st.retryable(err)
+	}
+	rs := newRows(st)
+	rs.start = start
+	rs.warnings = st.cn.appendWarning(nil)
+	if st.cn.cfg.RetryIdempotent && st.st.numCols() > 0 {
+		// fetch the first row so that losing the connection before it
+		// is available can still be retried
+		if ok, err := st.fetch(st.st.fetchNext); ok {
+			rs.positioned = true
+		} else if err != nil {
+			rs.Close()
+			return nil, st.retryable(err)
+		} else {
+			rs.exhausted = true
+		}
 	}
-	return &rows{st: st}, nil
+	return rs, nil
+}
+
+// Turns the loss of the connection into driver.ErrBadConn so that
+// database/sql re-runs the query on another connection if configured
+// with RetryIdempotent
+func (st *stmt) retryable(err error) error {
+	if st.cn.lost(err) && st.cn.cfg.RetryIdempotent {
+		return driver.ErrBadConn
+	}
+	return err
 }
 
 func (st *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	var start time.Time
+	if st.cn.cfg.SlowQueryThreshold > 0 {
+		start = time.Now()
+	}
 	if err := st.execute(args); err != nil {
 		return nil, err
 	}
+	warnings := st.cn.appendWarning(nil)
 	numrows := st.st.affectedRows()
-	r := &result{st: st, numaffected: int64(numrows)}
+	if err := st.deliverOuts(); err != nil {
+		return nil, err
+	}
+	r := &result{
+		st:          st,
+		numaffected: int64(numrows),
+		hasaffected: numrows >= 0 && !ddlRe.MatchString(st.query),
+		warnings:    warnings,
+	}
+	st.logSlow(start)
 	return r, nil
 }
 
+// Logs the statement if it has been running for longer than configured
+// with SlowQueryThreshold (start is zero if not configured)
+func (st *stmt) logSlow(start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	if d := time.Since(start); d > st.cn.cfg.SlowQueryThreshold {
+		st.cn.cfg.logger().Print(fmt.Sprintf("sqla: slow query (%s): %s", d, st.query))
+	}
+}
+
+// NumInput reports the number of parameters database/sql checks the
+// number of arguments against - -1 (no check) if the server could not
+// determine it or with Config.SkipArgCount. The count is checked by the
+// driver either way once []interface{} arguments have been flattened.
 func (st *stmt) NumInput() int {
-	return st.st.numParams()
+	if st.numparams < 0 || st.cn.cfg.SkipArgCount {
+		return -1
+	}
+	return st.numparams
 }
 
 type rows struct {
 	st *stmt
+	// columns of the current result set (valid if described)
+	cols      []string
+	meta      []ColumnMeta
+	described bool
+	// whether there's another result set (valid if nextChecked)
+	hasNext     bool
+	nextChecked bool
+	// per-column fetch buffers reused across rows
+	bufs [][]byte
+	// the cursor has been positioned on a row which is yet to be read
+	positioned bool
+	// the first fetch (see RetryIdempotent) found no rows
+	exhausted bool
+	// number of the row last returned by Next (see Position), negative
+	// if unknown
+	pos int64
+	// time the query started executing if slow queries are logged
+	start time.Time
+	// reported when the query (or a result set) was opened and with its
+	// first row (see Warnings)
+	warnings []Warning
+	// a row has been fetched
+	fetched bool
+	// prefetch option to restore on Close if it has been turned off for
+	// the query (see WithoutPrefetch)
+	prefetch string
+	// bytes of the values of the current row as received (only kept
+	// with Config.RawColumnDump)
+	raw [][]byte
+}
+
+// Reads the complete value of a LONG VARCHAR/BINARY column.
+// getColumn is not guaranteed to return the whole value so whatever is
+// missing is read with getData.
+func (rs *rows) longValue(i int, typ nativeType, data *dataValue) (driver.Value, error) {
+	info := &dataInfo{}
+	if ok := rs.st.st.getDataInfo(sacapi_u32(i), info); !ok {
+		return nil, rs.st.cn.cn.newError()
+	}
+	b := data.bufferValue(rs.bufs[i])
+	for size := int(info.datasize); len(b) < size; {
+		if cap(b) < size {
+			nb := make([]byte, len(b), size)
+			copy(nb, b)
+			b = nb
+		}
+		n := rs.st.st.getData(sacapi_u32(i), uintptr(len(b)), b[len(b):size])
+		if n < 0 {
+			return nil, rs.st.cn.cn.newError()
+		}
+		if n == 0 {
+			break
+		}
+		b = b[:len(b)+n]
+	}
+	rs.bufs[i] = b
+	if conv := converter(typ); conv != nil {
+		return conv(b)
+	}
+	if data.datatype == A_BINARY || rs.st.cn.cfg.StringsAsBytes {
+		return b, nil
+	}
+	return byteSliceToString(b), nil
+}
+
+func isLong(typ nativeType) bool {
+	switch typ {
+	case DT_LONGVARCHAR, DT_LONGBINARY, DT_LONGNVARCHAR:
+		return true
+	}
+	return false
+}
+
+// character types (excluding DECIMAL which is also fetched as a string)
+func isString(typ nativeType) bool {
+	switch typ {
+	case DT_VARCHAR, DT_FIXCHAR, DT_STRING, DT_LONGVARCHAR,
+		DT_NVARCHAR, DT_NFIXCHAR, DT_NSTRING, DT_LONGNVARCHAR:
+		return true
+	}
+	return false
+}
+
+// Applies NFC normalization to the values of character columns if
+// configured (Config.NormalizeUnicode)
+func (rs *rows) normalize(typ nativeType, v driver.Value) driver.Value {
+	if !rs.st.cn.cfg.NormalizeUnicode || !isString(typ) {
+		return v
+	}
+	switch v := v.(type) {
+	case string:
+		return norm.NFC.String(v)
+	case []byte:
+		return norm.NFC.Bytes(v)
+	}
+	return v
+}
+
+// CHAR/NCHAR (blank-padded if the database has been created with blank
+// padding)
+func isFixedChar(typ nativeType) bool {
+	return typ == DT_FIXCHAR || typ == DT_NFIXCHAR
+}
+
+// Signals the end of the current result set. Output parameters are
+// delivered after the last one - the native API only makes their values
+// available once all the result sets have been consumed.
+func (rs *rows) eof() error {
+	if len(rs.st.outs) > 0 && !rs.HasNextResultSet() {
+		if err := rs.st.deliverOuts(); err != nil {
+			return err
+		}
+	}
+	return io.EOF
+}
+
+// FetchAt positions the cursor on the row at pos (1-based, negative
+// values count from the end of the result set) so that the following
+// Next returns that row and iteration continues from there.
+// ok is false if there's no row at pos.
+// Returns ErrForwardOnly for forward-only cursors (requested with
+// Config.Cursor or restricted to FETCH NEXT by the server).
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver rows.
+func (rs *rows) FetchAt(pos int) (ok bool, err error) {
+	if rs.st.forwardOnly {
+		return false, ErrForwardOnly
+	}
+	rs.positioned = false
+	rs.exhausted = false
+	ok, err = rs.st.fetch(func() bool { return rs.st.st.fetchAbsolute(sacapi_i32(pos)) })
+	var serr *sqlaError
+	if errors.As(err, &serr) && serr.code == sqlcodeFetchNextOnly {
+		// the cursor stays where it is
+		rs.st.forwardOnly = true
+		return false, ErrForwardOnly
+	}
+	if !ok {
+		rs.pos = -1
+		return false, err
+	}
+	rs.positioned = true
+	// Next accounts for the row
+	if pos > 0 {
+		rs.pos = int64(pos) - 1
+	} else {
+		// counted from the end
+		rs.pos = -1
+	}
+	return true, nil
+}
+
+// Position returns the number (1-based) of the row last returned by Next
+// for progress reporting on large scans - 0 before the first row.
+// The position is counted by the driver so it is also reported for
+// forward-only cursors. ok is false after FetchAt from the end of the
+// result set.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver rows.
+func (rs *rows) Position() (pos int64, ok bool) {
+	if rs.pos < 0 {
+		return 0, false
+	}
+	return rs.pos, true
+}
+
+// EstimatedRows returns the number of rows of the current result set as
+// estimated by the server when the query was opened (e.g. to size a
+// progress bar) or -1 if no estimate is available.
+// The estimate is approximate - it is only exact if the server has
+// already materialized the result set - so the actual number of rows
+// returned by Next may differ either way.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver rows.
+func (rs *rows) EstimatedRows() int64 {
+	if rs.st.closed || rs.st.st.numCols() <= 0 {
+		return -1
+	}
+	n := rs.st.st.numRows()
+	if n < 0 {
+		n = -n
+	}
+	return int64(n)
+}
+
+// RawColumn returns the bytes of the value of column i of the current
+// row as received from the client library: text in the connection
+// character set (before any conversion by the driver) and numbers in
+// their machine representation. Returns nil for NULLs or unless
+// Config.RawColumnDump is set.
+// The bytes are only valid until the next call to Next.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver rows.
+func (rs *rows) RawColumn(i int) []byte {
+	if i < 0 || i >= len(rs.raw) {
+		return nil
+	}
+	return rs.raw[i]
+}
+
+// Keeps the bytes of the column value for RawColumn
+func (rs *rows) dumpColumn(i int, data *dataValue) {
+	if data.isNull() {
+		rs.raw[i] = nil
+		return
+	}
+	rs.raw[i] = data.raw(&rs.raw[i])
 }
 
 func (rs *rows) Close() error {
+	rs.st.closeCursor()
+	if rs.prefetch != "" {
+		rs.st.cn.setPrefetch(rs.prefetch)
+		rs.prefetch = ""
+	}
+	rs.st.logSlow(rs.start)
 	return nil
 }
 
+// Columns returns the names of the columns of the current result set
+// (updated by NextResultSet)
 func (rs *rows) Columns() []string {
-	return rs.st.cols
+	rs.describe()
+	return rs.cols
+}
+
+// NumColumns returns the number of columns of the current result set.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver rows.
+func (rs *rows) NumColumns() int {
+	rs.describe()
+	return len(rs.cols)
+}
+
+// rows of an executed statement
+func newRows(st *stmt) *rows {
+	rs := &rows{st: st}
+	if !st.cn.cfg.LazyColumns {
+		// described when prepared
+		rs.describe()
+	}
+	return rs
+}
+
+// Picks up the columns of the statement - described on first use with
+// Config.LazyColumns.
+// A failure is reported by Next (the result set has no columns until
+// then).
+func (rs *rows) describe() error {
+	if rs.described {
+		return nil
+	}
+	if err := rs.st.describe(); err != nil {
+		return err
+	}
+	rs.cols, rs.meta, rs.described = rs.st.cols, rs.st.meta, true
+	return nil
+}
+
+// HasNextResultSet implements driver.RowsNextResultSet.
+// database/sql only asks once the current result set has been consumed
+// so the cursor is moved to the next result set right away.
+func (rs *rows) HasNextResultSet() bool {
+	if !rs.nextChecked {
+		// a statement w/o a result set (such as a procedure only
+		// setting output parameters) has no further result sets either
+		rs.hasNext = rs.st.st.numCols() > 0 && rs.st.st.getNextResult()
+		rs.nextChecked = true
+	}
+	return rs.hasNext
+}
+
+// NextResultSet implements driver.RowsNextResultSet
+func (rs *rows) NextResultSet() error {
+	if !rs.HasNextResultSet() {
+		return io.EOF
+	}
+	cols, meta, err := rs.st.describeColumns()
+	if err != nil {
+		return err
+	}
+	rs.cols, rs.meta, rs.described = cols, meta, true
+	rs.nextChecked = false
+	rs.positioned = false
+	rs.exhausted = false
+	rs.pos = 0
+	rs.bufs = nil
+	rs.fetched = false
+	rs.warnings = rs.st.cn.appendWarning(rs.warnings)
+	return nil
+}
+
+// ColumnIndex returns the ordinal of the column with the given name
+// (compared case-insensitively as identifiers are in SQL Anywhere).
+// If several columns share the name, the first one is returned.
+// ok is false if there's no such column.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver rows.
+func (rs *rows) ColumnIndex(name string) (index int, ok bool) {
+	rs.describe()
+	for i, col := range rs.cols {
+		if strings.EqualFold(col, name) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// Warnings returns the warnings the server reported for the query when
+// it was opened, with its first row and with the row Next returned last
+// - some (such as NULLs eliminated in an aggregate) are only reported as
+// the rows are fetched. Warnings of the rows in between are only seen if
+// Warnings is called after each Next.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver rows.
+func (rs *rows) Warnings() []Warning {
+	if rs.st.executed && rs.fetched {
+		rs.warnings = rs.st.cn.appendWarning(rs.warnings)
+	}
+	return rs.warnings
+}
+
+// ColumnTypeScanType implements driver.RowsColumnTypeScanType.
+// Nullable columns report the sql.Null* type matching the column type.
+func (rs *rows) ColumnTypeScanType(index int) reflect.Type {
+	rs.describe()
+	return rs.meta[index].scanType()
+}
+
+// ColumnTypeLength implements driver.RowsColumnTypeLength.
+// String columns report their declared length: in characters for NCHAR
+// and NVARCHAR columns (which take up to 4 bytes per character) and in
+// bytes for CHAR and VARCHAR columns as SQL Anywhere declares them - with
+// a multibyte character set that is an upper bound of the number of
+// characters. Binary columns report their length in bytes and LONG
+// columns are unbounded (math.MaxInt64).
+func (rs *rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	rs.describe()
+	m := &rs.meta[index]
+	switch typ := nativeType(m.NativeType); {
+	case isLong(typ):
+		return math.MaxInt64, true
+	case typ == DT_BINARY:
+		return m.Length, true
+	case m.CharLength > 0:
+		return m.CharLength, true
+	}
+	return 0, false
+}
+
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable
+func (rs *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	rs.describe()
+	return rs.meta[index].Nullable, true
+}
+
+// ColumnMetadata describes all columns of the result set at once.
+// It is not part of database/sql and needs to be accessed with a type
+// assertion on the driver rows.
+func (rs *rows) ColumnMetadata() []ColumnMeta {
+	rs.describe()
+	meta := make([]ColumnMeta, len(rs.meta))
+	copy(meta, rs.meta)
+	return meta
 }
 
 func (rs *rows) Next(dest []driver.Value) (err error) {
-	if ok := rs.st.st.fetchNext(); !ok {
-		if err = rs.st.cn.cn.newError(); err != nil {
-			code := err.(*sqlaError).code
-			// check if the result set has really been exhausted
-			if code != 100 {
-				return
-			}
+	if err = rs.describe(); err != nil {
+		return
+	}
+	if len(rs.cols) == 0 {
+		// nothing to fetch (i.e. a procedure w/o a result set)
+		return rs.eof()
+	}
+	if rs.exhausted {
+		rs.exhausted = false
+		return rs.eof()
+	}
+	if rs.positioned {
+		// the row has already been fetched (by FetchAt or Query)
+		rs.positioned = false
+	} else if ok, ferr := rs.st.fetch(rs.st.st.fetchNext); !ok {
+		if ferr != nil {
+			return ferr
 		}
-		return io.EOF
+		return rs.eof()
+	}
+	if !rs.fetched {
+		// checking every row would cost a call into the C API per row
+		rs.warnings = rs.st.cn.appendWarning(rs.warnings)
+		rs.fetched = true
+	}
+	rs.st.cn.stats.RowsFetched++
+	if rs.pos >= 0 {
+		rs.pos++
 	}
 	if numcols := rs.st.st.numCols(); numcols > 0 {
+		if rs.bufs == nil {
+			rs.bufs = make([][]byte, numcols)
+			if size := rs.st.cn.cfg.FetchBufferSize; size > 0 {
+				for i := range rs.bufs {
+					rs.bufs[i] = make([]byte, 0, size)
+				}
+			}
+			if rs.st.cn.cfg.RawColumnDump {
+				rs.raw = make([][]byte, numcols)
+			}
+		}
 		data := &dataValue{}
 		for i := 0; i < numcols; i++ {
 			if ok := rs.st.st.getColumn(uint(i), data); !ok {
 				err = rs.st.cn.cn.newError()
 				return // simply abandon the result set?
 			}
-			dest[i] = data.Value()
+			typ := nativeType(rs.meta[i].NativeType)
+			if rs.raw != nil {
+				rs.dumpColumn(i, data)
+			}
+			if isLong(typ) && !data.isNull() {
+				if dest[i], err = rs.longValue(i, typ, data); err != nil {
+					return
+				}
+				if rs.raw != nil {
+					// the complete value rather than the first chunk
+					switch v := dest[i].(type) {
+					case string:
+						rs.raw[i] = append(rs.raw[i][:0], v...)
+					case []byte:
+						rs.raw[i] = append(rs.raw[i][:0], v...)
+					}
+				}
+				dest[i] = rs.normalize(typ, dest[i])
+				continue
+			}
+			if conv := converter(typ); conv != nil && !data.isNull() {
+				if dest[i], err = conv(data.raw(&rs.bufs[i])); err != nil {
+					return
+				}
+				continue
+			}
+			if isString(typ) && rs.st.cn.cfg.StringsAsBytes && !data.isNull() {
+				// aliases the fetch buffer like binary values
+				dest[i] = rs.normalize(typ, data.raw(&rs.bufs[i]))
+				continue
+			}
+			dest[i] = data.value(&rs.bufs[i])
+			switch {
+			case isTemporal(typ):
+				dest[i] = parseTemporal(dest[i], rs.st.cn.cfg.location())
+			case typ == DT_FLOAT:
+				// REAL (and FLOAT(p) up to single precision) may be
+				// reported as A_DOUBLE - decoded as float32 nevertheless
+				// so the value is what has been stored
+				if f, ok := dest[i].(float64); ok {
+					dest[i] = float32(f)
+				}
+			case typ == DT_DECIMAL && rs.st.cn.cfg.DecimalAs == DecimalAsFloat:
+				if s, ok := dest[i].(string); ok {
+					truncate := rs.st.cn.cfg.DecimalRounding == DecimalTruncate
+					if dest[i], err = decimalFloat(s, truncate); err != nil {
+						return
+					}
+				}
+			case typ == DT_BIT && rs.st.cn.cfg.BitAsBool:
+				// reported as A_UVAL8 like TINYINT
+				if b, ok := dest[i].(uint8); ok {
+					dest[i] = b != 0
+				}
+			case typ == DT_TINYINT:
+				// TINYINT is unsigned (0 to 255) - a byte reported as
+				// A_VAL8 would read values from 128 up as negative
+				if b, ok := dest[i].(int8); ok {
+					dest[i] = uint8(b)
+				}
+			case isFixedChar(typ) && rs.st.cn.cfg.TrimChar:
+				if s, ok := dest[i].(string); ok {
+					dest[i] = strings.TrimRight(s, " ")
+				}
+			}
+			dest[i] = rs.normalize(typ, dest[i])
 		}
 	}
 	return nil
@@ -3,12 +3,26 @@
 package sqlany
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
 // tests (mostly unmodified) courtesy of github.com/bmizerany/pq
@@ -16,8 +30,10 @@ type Fataler interface {
 	Fatal(args ...interface{})
 }
 
+const testDSN = "uid=dba;pwd=sql;dbf=test;eng=test"
+
 func openTestConn(t Fataler) *sql.DB {
-	db, err := sql.Open("sqlany", "uid=dba;pwd=sql;dbf=test;eng=test")
+	db, err := sql.Open("sqlany", testDSN)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -54,6 +70,96 @@ func TestExec(t *testing.T) {
 	}
 }
 
+func TestExecInsertSelect(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #src (a INT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE #dst (a INT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 7; i++ {
+		if _, err = db.Exec("INSERT INTO #src VALUES (?)", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st, err := db.Prepare("INSERT INTO #dst SELECT a FROM #src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	// run the prepared statement twice to make sure the count does not
+	// accumulate across executions
+	for i := 0; i < 2; i++ {
+		r, err := st.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := r.RowsAffected(); n != 7 {
+			t.Fatalf("expected 7 rows affected, not %d", n)
+		}
+	}
+}
+
+func TestExecDeleteCascade(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	t2 := params{t, db}
+
+	t2.mustExec("CREATE TABLE parent (id INT PRIMARY KEY)")
+	defer db.Exec("DROP TABLE parent")
+	t2.mustExec(`CREATE TABLE child (id INT PRIMARY KEY, parent_id INT NOT NULL
+		REFERENCES parent (id) ON DELETE CASCADE)`)
+	defer db.Exec("DROP TABLE child")
+
+	t2.mustExec("INSERT INTO parent VALUES (1)")
+	t2.mustExec("INSERT INTO parent VALUES (2)")
+	for i := 1; i <= 3; i++ {
+		t2.mustExec("INSERT INTO child VALUES (?, 1)", i)
+	}
+
+	r := t2.mustExec("DELETE FROM parent WHERE id = 1")
+	// cascaded deletes are not counted
+	if n, _ := r.RowsAffected(); n != 1 {
+		t.Fatalf("expected 1 row affected, not %d", n)
+	}
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM child").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected the child rows to be deleted, %d left", n)
+	}
+}
+
+func TestRowsAffectedDDL(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	r, err := db.Exec("CREATE TABLE #ddl (a INT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.RowsAffected(); err != ErrNoRowsAffected {
+		t.Fatalf("expected ErrNoRowsAffected after DDL, got %v", err)
+	}
+
+	r, err = db.Exec("UPDATE #ddl SET a = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.RowsAffected(); err != nil || n != 0 {
+		t.Fatalf("expected 0 rows affected, got %d (%v)", n, err)
+	}
+}
+
 func TestStatment(t *testing.T) {
 	db := openTestConn(t)
 	defer db.Close()
@@ -161,6 +267,142 @@ func TestNoData(t *testing.T) {
 	}
 }
 
+func TestCloseCursorOnce(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT 1")
+		st := rs.st
+		if !st.executed {
+			t.Fatal("expected an open cursor")
+		}
+		rs.Close()
+		if st.executed {
+			t.Fatal("expected the cursor to be closed")
+		}
+		// the statement does not close (and commit) again
+		st.Close()
+		if _, err := cn.Scalar(context.Background(), "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestCommitFailure(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE commit_parent (id INT PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE commit_parent")
+	if _, err := db.Exec("CREATE TABLE commit_child (pid INT REFERENCES commit_parent (id))"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE commit_child")
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// referential integrity is only checked by COMMIT
+	if _, err = c.ExecContext(ctx, "SET TEMPORARY OPTION wait_for_commit = 'On'"); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("INSERT INTO commit_child VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err == nil {
+		t.Fatal("expected the commit to fail")
+	}
+
+	// the connection is usable for another transaction
+	tx, err = c.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err = tx.QueryRow("SELECT count(*) FROM commit_child").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected the failed transaction to be rolled back, got %d rows", n)
+	}
+}
+
+func TestNestedBegin(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		tx, err := cn.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = cn.Begin(); err != errTxActive {
+			t.Fatalf("expected errTxActive, got %v", err)
+		}
+		if err = tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		if err = tx.Commit(); err == nil {
+			t.Fatal("expected an error ending the transaction twice")
+		}
+		// a new transaction can be started once the first one ended
+		tx, err = cn.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestBeginTxIsolation(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	isolation := func(q interface {
+		QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+	}) string {
+		var level string
+		if err := q.QueryRowContext(ctx, "SELECT connection_property('isolation_level')").Scan(&level); err != nil {
+			t.Fatal(err)
+		}
+		return level
+	}
+	before := isolation(db)
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level := isolation(tx); level != "3" {
+		t.Fatalf("expected isolation level 3 within the transaction, got %s", level)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if level := isolation(db); level != before {
+		t.Fatalf("expected isolation level %s to be restored, got %s", before, level)
+	}
+	if _, err = db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err == nil {
+		t.Fatal("expected read-only transactions to be rejected")
+	}
+}
+
 func TestSQLAError(t *testing.T) {
 	// Don't use the normal connection setup, this is intended to
 	// blow up in the startup packet from a non-existent user.
@@ -180,6 +422,16 @@ func TestSQLAError(t *testing.T) {
 	}
 }
 
+func TestAuthFailed(t *testing.T) {
+	_, err := (&drv{}).Open("uid=dba;pwd=notthepassword;dbf=test;eng=test")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got: %v", err)
+	}
+}
+
 func TestBindError(t *testing.T) {
 	db := openTestConn(t)
 	defer db.Close()
@@ -202,6 +454,3396 @@ func TestBindError(t *testing.T) {
 	defer r.Close()
 }
 
+func TestConfiguredCharSet(t *testing.T) {
+	c, err := (&drv{}).Open(testDSN + ";charset=utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if cs := c.(*conn).charset; cs != "utf8" {
+		t.Fatalf("expected configured charset utf8, got %q", cs)
+	}
+}
+
+func benchmarkOpen(b *testing.B, dsn string) {
+	d := &drv{}
+	for i := 0; i < b.N; i++ {
+		c, err := d.Open(dsn)
+		if err != nil {
+			b.Fatal(err)
+		}
+		c.Close()
+	}
+}
+
+func TestOpenPing(t *testing.T) {
+	cfg, err := ParseDSN(testDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Ping = true
+	c, err := (&drv{}).Open(cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
+
+func TestOpenCompress(t *testing.T) {
+	cfg, err := ParseDSN(testDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Compress = true
+	db, err := sql.Open(DriverName, cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var compressed string
+	if err = db.QueryRow("SELECT connection_property('Compression')").Scan(&compressed); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.EqualFold(compressed, "on") {
+		t.Fatalf("expected a compressed connection, got %q", compressed)
+	}
+}
+
+func TestConnectCanceled(t *testing.T) {
+	cfg, err := ParseDSN(testDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = c.Connect(ctx); err != context.Canceled {
+		t.Fatalf("expected the connect to be canceled, got %v", err)
+	}
+
+	// canceled while the character set is being queried
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		cn, err := c.Connect(ctx)
+		if err == nil {
+			cn.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err != nil && err != context.DeadlineExceeded {
+			t.Fatalf("expected the connect to succeed or time out, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("connect did not return after the deadline")
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	db, err := sql.Open(DriverName, testDSN+";fetch_timeout=500ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE FUNCTION slow_row(n INT) RETURNS INT
+		BEGIN
+			IF n = 2 THEN
+				WAITFOR DELAY '00:00:10'
+			END IF;
+			RETURN n
+		END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP FUNCTION slow_row")
+
+	start := time.Now()
+	rows, err := db.Query("SELECT slow_row(row_num) FROM sa_rowgenerator(1, 3)")
+	if err == nil {
+		for rows.Next() {
+		}
+		err = rows.Err()
+		rows.Close()
+	}
+	if err != ErrFetchTimeout {
+		t.Fatalf("expected the fetch to time out, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("expected the fetch to be canceled on the server, took %s", d)
+	}
+
+	// the connection is still usable
+	var n int
+	if err = db.QueryRow("SELECT count(*) FROM sa_rowgenerator(1, 3)").Scan(&n); err != nil || n != 3 {
+		t.Fatalf("expected 3 rows, got %d (%v)", n, err)
+	}
+}
+
+func TestPingDeadline(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err := db.Exec(`CREATE FUNCTION slow_ping() RETURNS VARCHAR(128)
+		BEGIN
+			WAITFOR DELAY '00:00:10';
+			RETURN connection_property('Name')
+		END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP FUNCTION slow_ping")
+	var before, after int
+	if err = db.QueryRow("SELECT connection_property('Number')").Scan(&before); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(query string) { pingQuery = query }(pingQuery)
+	pingQuery = "select slow_ping()"
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err = db.PingContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline to be reported, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("expected the ping to be canceled on the server, took %s", d)
+	}
+
+	// the pool kept the connection rather than discarding it
+	if err = db.QueryRow("SELECT connection_property('Number')").Scan(&after); err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Fatalf("expected connection %d to be reused, got %d", before, after)
+	}
+}
+
+func BenchmarkOpen(b *testing.B) {
+	benchmarkOpen(b, testDSN)
+}
+
+func BenchmarkOpenSkipCharSetQuery(b *testing.B) {
+	benchmarkOpen(b, testDSN+";skip_charset_query=yes")
+}
+
+func TestLazyColumns(t *testing.T) {
+	db, err := sql.Open(DriverName, testDSN+";lazy_columns=yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		s, err := cn.Prepare("SELECT 1 AS a, 'x' AS b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		if st := s.(*stmt); st.described {
+			t.Fatal("expected the columns not to be described when preparing")
+		}
+		rs, err := s.Query(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+		if cols := rs.Columns(); !reflect.DeepEqual(cols, []string{"a", "b"}) {
+			t.Fatalf("expected columns a and b, got %v", cols)
+		}
+		dest := make([]driver.Value, 2)
+		if err = rs.Next(dest); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(dest) != "[1 x]" {
+			t.Fatalf("expected [1 x], got %v", dest)
+		}
+	})
+}
+
+func benchmarkPrepare(b *testing.B, dsn string) {
+	c, err := (&drv{}).Open(dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s, err := c.Prepare("SELECT * FROM SYS.SYSTAB")
+		if err != nil {
+			b.Fatal(err)
+		}
+		s.Close()
+	}
+}
+
+func BenchmarkPrepare(b *testing.B) {
+	benchmarkPrepare(b, testDSN)
+}
+
+func BenchmarkPrepareLazyColumns(b *testing.B) {
+	benchmarkPrepare(b, testDSN+";lazy_columns=yes")
+}
+
+func TestChunkedParam(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #big (s LONG VARCHAR)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// well above the default max_inline_param of 64KB
+	want := strings.Repeat("0123456789abcdef", 1<<16)
+	if _, err = db.Exec("INSERT INTO #big VALUES (?)", want); err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	if err = db.QueryRow("SELECT s FROM #big").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("expected a %d byte string back, got %d bytes", len(want), len(got))
+	}
+}
+
+// runs fn with the driver connection underlying a database/sql connection
+func withConn(t *testing.T, db *sql.DB, fn func(cn *conn)) {
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Raw(func(dc interface{}) error {
+		fn(dc.(*conn))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// prepares and runs the query on the driver connection directly
+func rawQuery(t *testing.T, cn *conn, query string, args ...driver.Value) *rows {
+	st, err := cn.Prepare(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := st.Query(args)
+	if err != nil {
+		st.Close()
+		t.Fatal(err)
+	}
+	return rs.(*rows)
+}
+
+func TestUpdateLOB(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE lob_items (id INT, b LONG BINARY)"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE lob_items")
+	want := bytes.Repeat([]byte("0123456789"), 100000)
+	if _, err := db.Exec("INSERT INTO lob_items VALUES (1, ?), (2, ?)", want, want); err != nil {
+		t.Fatal(err)
+	}
+	var id RowID
+	if err := db.QueryRow("SELECT ROWID(lob_items) FROM lob_items WHERE id = 1").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+
+	withConn(t, db, func(cn *conn) {
+		ctx := context.Background()
+		// qualified with the owner of the table (the test user)
+		if err := cn.UpdateLOB(ctx, "dba.lob_items", "b", id, 500000, []byte("abc")); err != nil {
+			t.Fatal(err)
+		}
+		if err := cn.UpdateLOB(ctx, "lob_items", "b", id, int64(len(want))+1, []byte("x")); err == nil {
+			t.Fatal("expected an offset past the end of the value to be rejected")
+		}
+	})
+	copy(want[500000:], "abc")
+	var got []byte
+	if err := db.QueryRow("SELECT b FROM lob_items WHERE id = 1").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected only bytes 500000 to 500002 to change, got %d bytes with abc at %d",
+			len(got), bytes.Index(got, []byte("abc")))
+	}
+	// other rows are left alone
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM lob_items WHERE id = 2 AND LOCATE(b, 'abc') = 0").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatal("expected the other row to be unchanged")
+	}
+}
+
+func TestLongValue(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #long (s LONG VARCHAR, b LONG BINARY)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Repeat("x", 200<<10)
+	if _, err = db.Exec("INSERT INTO #long VALUES (?, ?)", want, []byte(want)); err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	var b []byte
+	if err = db.QueryRow("SELECT s, b FROM #long").Scan(&s, &b); err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != len(want) || s != want {
+		t.Fatalf("expected a %d byte string, got %d bytes", len(want), len(s))
+	}
+	if len(b) != len(want) {
+		t.Fatalf("expected %d bytes of binary, got %d", len(want), len(b))
+	}
+}
+
+func TestColumnMetadata(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #meta (i INT NOT NULL, s VARCHAR(10) NULL, d DOUBLE NULL, n NUMERIC(10,2) NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT i, s, d, n FROM #meta")
+		defer rs.st.Close()
+
+		want := []ColumnMeta{
+			{Name: "i", NativeType: DT_INT, GoType: reflect.TypeOf(int32(0)), Length: 4},
+			{Name: "s", NativeType: DT_VARCHAR, GoType: reflect.TypeOf(""), Length: 10, Nullable: true},
+			{Name: "d", NativeType: DT_DOUBLE, GoType: reflect.TypeOf(float64(0)), Length: 8, Nullable: true},
+			{Name: "n", NativeType: DT_DECIMAL, GoType: reflect.TypeOf(""), Precision: 10, Scale: 2},
+		}
+		got := rs.ColumnMetadata()
+		if len(got) != len(want) {
+			t.Fatalf("expected %d columns, got %d", len(want), len(got))
+		}
+		for i, m := range got {
+			w := want[i]
+			if m.Name != w.Name || m.NativeType != w.NativeType || m.GoType != w.GoType ||
+				m.Nullable != w.Nullable {
+				t.Errorf("column %d: expected %+v, got %+v", i, w, m)
+			}
+			if w.Length != 0 && m.Length != w.Length {
+				t.Errorf("column %d: expected length %d, got %d", i, w.Length, m.Length)
+			}
+			if w.Precision != 0 && (m.Precision != w.Precision || m.Scale != w.Scale) {
+				t.Errorf("column %d: expected precision/scale %d/%d, got %d/%d", i,
+					w.Precision, w.Scale, m.Precision, m.Scale)
+			}
+		}
+	})
+}
+
+func TestDescribe(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		info, err := cn.Describe("SELECT table_id, table_name FROM SYS.SYSTAB WHERE table_id = ?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(info.Params) != 1 || !info.Params[0].Input || info.Params[0].Output {
+			t.Fatalf("expected a single input parameter, got %+v", info.Params)
+		}
+		if len(info.Columns) != 2 || info.Columns[0].Name != "table_id" || info.Columns[1].Name != "table_name" {
+			t.Fatalf("expected columns table_id and table_name, got %+v", info.Columns)
+		}
+		if info.Columns[1].GoType != reflect.TypeOf("") {
+			t.Fatalf("expected table_name to be a string, got %v", info.Columns[1].GoType)
+		}
+
+		if _, err = cn.Describe("SELECT FROM"); err == nil {
+			t.Fatal("expected an error for malformed SQL")
+		}
+	})
+}
+
+func TestExplain(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		plan, err := cn.Explain(context.Background(), "SELECT table_name FROM SYS.SYSTAB WHERE table_id = ?", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(plan) == "" {
+			t.Fatal("expected a plan")
+		}
+	})
+}
+
+func TestColumnTypeLength(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE #lengths (n NVARCHAR(20), v VARCHAR(30), b VARBINARY(16), l LONG VARCHAR, i INT)"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query("SELECT n, v, b, l, i FROM #lengths")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int64{20, 30, 16, math.MaxInt64} {
+		if length, ok := types[i].Length(); !ok || length != want {
+			t.Errorf("expected length %d for %s, got %d (%t)", want, types[i].Name(), length, ok)
+		}
+	}
+	if _, ok := types[4].Length(); ok {
+		t.Error("expected no length for an INT column")
+	}
+}
+
+func TestColumnScanType(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec(`CREATE TABLE #scan (
+		i INT NOT NULL, ni INT NULL,
+		d DOUBLE NOT NULL, nd DOUBLE NULL,
+		s VARCHAR(10) NOT NULL, ns VARCHAR(10) NULL)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.Query("SELECT i, ni, d, nd, s, ns FROM #scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	types, err := r.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []reflect.Type{
+		reflect.TypeOf(int32(0)), reflect.TypeOf(sql.NullInt64{}),
+		reflect.TypeOf(float64(0)), reflect.TypeOf(sql.NullFloat64{}),
+		reflect.TypeOf(""), reflect.TypeOf(sql.NullString{}),
+	}
+	for i, ct := range types {
+		if ct.ScanType() != want[i] {
+			t.Errorf("%s: expected scan type %v, got %v", ct.Name(), want[i], ct.ScanType())
+		}
+		nullable, ok := ct.Nullable()
+		if !ok || nullable != (i%2 == 1) {
+			t.Errorf("%s: unexpected nullability %t", ct.Name(), nullable)
+		}
+	}
+}
+
+func TestMultibyteString(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #mb (s VARCHAR(100))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "héllo, 世界 \U0001F600!"
+	if _, err = db.Exec("INSERT INTO #mb VALUES (?)", want); err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	var size int
+	if err = db.QueryRow("SELECT s, byte_length(s) FROM #mb").Scan(&got, &size); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if size != len(want) {
+		t.Fatalf("expected %d bytes stored, got %d", len(want), size)
+	}
+}
+
+func TestTrimChar(t *testing.T) {
+	for _, trim := range []bool{false, true} {
+		db, err := sql.Open(DriverName, fmt.Sprintf("%s;trim_char=%t", testDSN, trim))
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		if _, err = db.Exec("CREATE TABLE #chars (c CHAR(10), v VARCHAR(10))"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = db.Exec("INSERT INTO #chars VALUES ('abc       ', 'abc   ')"); err != nil {
+			t.Fatal(err)
+		}
+		var c, v string
+		if err = db.QueryRow("SELECT c, v FROM #chars").Scan(&c, &v); err != nil {
+			t.Fatal(err)
+		}
+		want := "abc       "
+		if trim {
+			want = "abc"
+		}
+		if c != want || v != "abc   " {
+			t.Fatalf("expected %q and %q with trim_char=%t, got %q and %q", want, "abc   ", trim, c, v)
+		}
+		db.Close()
+	}
+}
+
+func TestNormalizeUnicode(t *testing.T) {
+	db, err := sql.Open(DriverName, testDSN+";normalize_unicode=yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const decomposed, composed = "caf\u0065\u0301", "caf\u00e9"
+	var bound, fetched string
+	err = db.QueryRow("SELECT CAST(? AS NVARCHAR(10)), CAST('"+decomposed+"' AS NVARCHAR(10))", decomposed).Scan(&bound, &fetched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bound != composed {
+		t.Fatalf("expected the parameter to be bound as %q, got %q", composed, bound)
+	}
+	if fetched != composed {
+		t.Fatalf("expected the value to be returned as %q, got %q", composed, fetched)
+	}
+}
+
+func TestStringsAsBytes(t *testing.T) {
+	db, err := sql.Open(DriverName, testDSN+";strings_as_bytes=yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.Exec("CREATE TABLE #strs (v VARCHAR(20), l LONG VARCHAR, d DECIMAL(10,2))"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("INSERT INTO #strs VALUES ('héllo', 'long', 1.5)"); err != nil {
+		t.Fatal(err)
+	}
+	var b []byte
+	var s string
+	var l, d interface{}
+	if err = db.QueryRow("SELECT v, v, l, d FROM #strs").Scan(&b, &s, &l, &d); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "héllo" || s != "héllo" {
+		t.Fatalf("expected héllo, got %q and %q", b, s)
+	}
+	if lb, ok := l.([]byte); !ok || string(lb) != "long" {
+		t.Fatalf("expected the LONG VARCHAR as bytes, got %#v", l)
+	}
+	if _, ok := d.(string); !ok {
+		t.Fatalf("expected DECIMAL values to stay strings, got %T", d)
+	}
+}
+
+func TestNationalString(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #nstr (a NVARCHAR(20), b NCHAR(10), c LONG NVARCHAR)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "漢字かなカナ한글"
+	if _, err = db.Exec("INSERT INTO #nstr VALUES (?, ?, ?)", want, want, want); err != nil {
+		t.Fatal(err)
+	}
+	var a, b, c string
+	if err = db.QueryRow("SELECT a, b, c FROM #nstr").Scan(&a, &b, &c); err != nil {
+		t.Fatal(err)
+	}
+	if a != want || strings.TrimRight(b, " ") != want || c != want {
+		t.Fatalf("expected %q, got %q, %q and %q", want, a, b, c)
+	}
+	var n int
+	if err = db.QueryRow("SELECT count(*) FROM #nstr WHERE a = ?", want).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected the NVARCHAR value to match, got %d rows", n)
+	}
+}
+
+func TestScalar(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #t (a INT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = db.Exec("INSERT INTO #t VALUES (?)", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	withConn(t, db, func(cn *conn) {
+		ctx := context.Background()
+		v, err := cn.Scalar(ctx, "SELECT count(*) FROM #t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := fmt.Sprint(v); s != "3" {
+			t.Fatalf("expected count of 3, got %s", s)
+		}
+
+		_, err = cn.Scalar(ctx, "SELECT a FROM #t WHERE a > ?", 10)
+		if err != sql.ErrNoRows {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+}
+
+func TestWatchCancelStop(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		for i := 0; i < 100; i++ {
+			ctx, cancel := context.WithCancel(context.Background())
+			stop := cn.watchCancel(ctx)
+			// races the cancel with the stop
+			go cancel()
+			stop()
+			if _, err := cn.Scalar(context.Background(), "SELECT 1"); err != nil {
+				t.Fatalf("iteration %d: the cancel hit the next query: %v", i, err)
+			}
+		}
+	})
+}
+
+func TestServerTime(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		now, err := cn.ServerTime()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(now); d < -5*time.Second || d > 5*time.Second {
+			t.Fatalf("expected the server time to be close to %v, got %v", time.Now(), now)
+		}
+	})
+}
+
+func TestQueryColumnar(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	const query = "SELECT row_num, 'r' || row_num, row_num * 1.5 FROM sa_rowgenerator(1, 4) WHERE row_num > ? ORDER BY row_num"
+	rows, err := db.Query(query, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var byRow [][]interface{}
+	for rows.Next() {
+		row := make([]interface{}, 3)
+		if err = rows.Scan(&row[0], &row[1], &row[2]); err != nil {
+			t.Fatal(err)
+		}
+		byRow = append(byRow, row)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	withConn(t, db, func(cn *conn) {
+		cols, data, err := cn.QueryColumnar(context.Background(), query, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cols) != 3 || len(data) != 3 {
+			t.Fatalf("expected 3 columns, got %q and %d", cols, len(data))
+		}
+		for i := range data {
+			if len(data[i]) != len(byRow) {
+				t.Fatalf("expected %d values in column %d, got %d", len(byRow), i, len(data[i]))
+			}
+			for j, v := range data[i] {
+				if !reflect.DeepEqual(v, byRow[j][i]) {
+					t.Errorf("column %d, row %d: expected %#v, got %#v", i, j, byRow[j][i], v)
+				}
+			}
+		}
+	})
+}
+
+func TestQueryStream(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		const query = "SELECT row_num, 'r' || row_num FROM sa_rowgenerator(1, ?) ORDER BY row_num"
+		rows, errc := cn.QueryStream(context.Background(), query, 1000)
+		var n int64
+		for row := range rows {
+			n++
+			if fmt.Sprint(row[0]) != strconv.FormatInt(n, 10) || row[1] != "r"+strconv.FormatInt(n, 10) {
+				t.Fatalf("unexpected row %v", row)
+			}
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		if n != 1000 {
+			t.Fatalf("expected 1000 rows, got %d", n)
+		}
+
+		// stops fetching once canceled
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		rows, errc = cn.QueryStream(ctx, query, 1000000)
+		n = 0
+		for range rows {
+			if n++; n == 10 {
+				cancel()
+			}
+		}
+		if err := <-errc; err != context.Canceled {
+			t.Fatalf("expected the stream to be canceled, got %v", err)
+		}
+		if n > 11 {
+			t.Fatalf("expected no rows after the cancel, got %d", n)
+		}
+		if _, err := cn.Scalar(context.Background(), "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestWithoutPrefetch(t *testing.T) {
+	db, err := sql.Open(DriverName, testDSN+";PrefetchRows=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	property := func(name string) string {
+		var v string
+		if err := db.QueryRow("SELECT connection_property(?)", name).Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	// number of requests the server received for fetching 50 rows
+	requests := func(ctx context.Context) int {
+		before, _ := strconv.Atoi(property("RequestsReceived"))
+		rows, err := db.QueryContext(ctx, "SELECT row_num FROM sa_rowgenerator(1, 50)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		if err = rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+		if n != 50 {
+			t.Fatalf("expected 50 rows, got %d", n)
+		}
+		after, _ := strconv.Atoi(property("RequestsReceived"))
+		return after - before
+	}
+
+	ctx := context.Background()
+	prefetch := property("prefetch")
+	if n := requests(ctx); n >= 50 {
+		t.Fatalf("expected the rows to be prefetched, got %d requests", n)
+	}
+	if n := requests(WithoutPrefetch(ctx)); n < 50 {
+		t.Fatalf("expected a request per row without prefetch, got %d requests", n)
+	}
+	if p := property("prefetch"); p != prefetch {
+		t.Fatalf("expected the prefetch option to be restored to %s, got %s", prefetch, p)
+	}
+}
+
+func TestScalarFetchError(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #f (a VARCHAR(10))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("INSERT INTO #f VALUES ('x')"); err != nil {
+		t.Fatal(err)
+	}
+
+	withConn(t, db, func(cn *conn) {
+		ctx := context.Background()
+		_, err := cn.Scalar(ctx, "SELECT CAST(a AS INT) FROM #f WHERE a = 'y'")
+		if err != sql.ErrNoRows {
+			t.Fatalf("expected sql.ErrNoRows for an empty result, got %v", err)
+		}
+
+		// the conversion fails when the row is fetched
+		_, err = cn.Scalar(ctx, "SELECT CAST(a AS INT) FROM #f")
+		if err == nil || err == sql.ErrNoRows || err == io.EOF {
+			t.Fatalf("expected a conversion error, got %v", err)
+		}
+
+		var s string
+		if err = cn.queryRow("SELECT a FROM #f WHERE a = 'y'", &s); err != io.EOF {
+			t.Fatalf("expected io.EOF for an empty result, got %v", err)
+		}
+		if err = cn.queryRow("SELECT CAST(a AS INT) FROM #f", &s); err == nil || err == io.EOF {
+			t.Fatalf("expected a conversion error, got %v", err)
+		}
+	})
+}
+
+func TestExpandInBind(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #in (a INT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err = db.Exec("INSERT INTO #in VALUES (?)", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query, args := ExpandIn("SELECT count(*) FROM #in WHERE a IN (?)", []int{1, 2, 3})
+	var n int
+	if err = db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 matching rows, got %d", n)
+	}
+}
+
+func TestNumInput(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		db, err := sql.Open(DriverName, fmt.Sprintf("%s;skip_arg_count=%t", testDSN, skip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		withConn(t, db, func(cn *conn) {
+			for query, want := range map[string]int{"SELECT ?": 1, "SELECT ?, ?, ?": 3} {
+				s, err := cn.Prepare(query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if skip {
+					want = -1
+				}
+				if n := s.NumInput(); n != want {
+					t.Fatalf("expected %d inputs for %q with skip_arg_count=%t, got %d", want, query, skip, n)
+				}
+				s.Close()
+			}
+		})
+		// the values of a single argument bind all the placeholders
+		var a int
+		var b string
+		var c float64
+		err = db.QueryRow("SELECT ?, ?, ?", []interface{}{1, "a", 2.5}).Scan(&a, &b, &c)
+		if skip {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a != 1 || b != "a" || c != 2.5 {
+				t.Fatalf("unexpected values %d, %q and %v", a, b, c)
+			}
+		} else if err == nil {
+			t.Fatal("expected database/sql to check the number of arguments")
+		}
+		// too few arguments are rejected either way (by the driver with
+		// skip_arg_count)
+		rs, err := db.Query("SELECT ?, ?", 1)
+		if err == nil {
+			rs.Close()
+			t.Fatalf("expected a 2-parameter statement with 1 argument to fail with skip_arg_count=%t", skip)
+		}
+		db.Close()
+	}
+}
+
+func TestBindTypedValue(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	i := make([]byte, 8)
+	binary.LittleEndian.PutUint64(i, uint64(1<<40+1))
+	f := make([]byte, 8)
+	binary.LittleEndian.PutUint64(f, math.Float64bits(2.5))
+	var (
+		a int64
+		b float64
+		c string
+		d sql.NullString
+	)
+	err := db.QueryRow("SELECT ?, ?, ?, CAST(? AS VARCHAR(10))",
+		TypedValue{Datatype: int(A_VAL64), Buffer: i},
+		TypedValue{Datatype: int(A_DOUBLE), Buffer: f},
+		TypedValue{Datatype: int(A_STRING), Buffer: []byte("héllo")},
+		TypedValue{Datatype: int(A_STRING)}).Scan(&a, &b, &c, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != 1<<40+1 || b != 2.5 || c != "héllo" || d.Valid {
+		t.Fatalf("unexpected values %d, %v, %q and %v", a, b, c, d)
+	}
+
+	if _, err = db.Exec("SELECT ?", TypedValue{Datatype: int(A_VAL32), Buffer: i}); err == nil {
+		t.Fatal("expected an error for a buffer of the wrong size")
+	}
+}
+
+func benchmarkBind(b *testing.B, arg func(i int) driver.Value) {
+	c, err := (&drv{}).Open(testDSN)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+	st, err := c.Prepare("SELECT ?, ?, ?, ?")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer st.Close()
+	args := make([]driver.Value, 4)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range args {
+			args[j] = arg(i)
+		}
+		rs, err := st.Query(args)
+		if err != nil {
+			b.Fatal(err)
+		}
+		rs.Close()
+	}
+}
+
+func BenchmarkBindReflect(b *testing.B) {
+	benchmarkBind(b, func(i int) driver.Value {
+		return int64(i)
+	})
+}
+
+func BenchmarkBindTyped(b *testing.B) {
+	buf := make([]byte, 8)
+	benchmarkBind(b, func(i int) driver.Value {
+		binary.LittleEndian.PutUint64(buf, uint64(i))
+		return TypedValue{Datatype: int(A_VAL64), Buffer: buf}
+	})
+}
+
+func TestBindRunes(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE #runes (s VARCHAR(32))"); err != nil {
+		t.Fatal(err)
+	}
+	const want = "Grüße, 世界 🌍"
+	if _, err := db.Exec("INSERT INTO #runes VALUES (?)", []rune(want)); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := db.QueryRow("SELECT s FROM #runes WHERE s = ?", []rune(want)).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestBindJSONNumber(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE #json (i INTEGER, d NUMERIC(10,2))"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO #json VALUES (?, ?)", json.Number("12345"), json.Number("123.45")); err != nil {
+		t.Fatal(err)
+	}
+	var i int64
+	var d string
+	if err := db.QueryRow("SELECT i, d FROM #json").Scan(&i, &d); err != nil {
+		t.Fatal(err)
+	}
+	if i != 12345 {
+		t.Fatalf("expected 12345, got %d", i)
+	}
+	if d != "123.45" {
+		t.Fatalf("expected 123.45, got %q", d)
+	}
+}
+
+func TestBindFlattenedValues(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		s, err := cn.Prepare("SELECT ?, ?, ?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		rs, err := s.Query([]driver.Value{[]interface{}{1, "a", 2.5}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+		row := make([]driver.Value, 3)
+		if err = rs.Next(row); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(row) != "[1 a 2.5]" {
+			t.Fatalf("unexpected row %v", row)
+		}
+	})
+}
+
+func TestResetParams(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		s, err := cn.Prepare("SELECT ?, ?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		query := func(args ...driver.Value) string {
+			rs, err := s.Query(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Close()
+			row := make([]driver.Value, 2)
+			if err = rs.Next(row); err != nil {
+				t.Fatal(err)
+			}
+			return fmt.Sprint(row)
+		}
+		if got := query(strings.Repeat("x", 40000), int64(1)); len(got) < 40000 {
+			t.Fatalf("unexpected row %.20s", got)
+		}
+		// a shorter value and a NULL in place of the previous values
+		if got := query("ab", nil); got != "[ab <nil>]" {
+			t.Fatalf("unexpected row %v", got)
+		}
+		st := s.(*stmt)
+		st.ResetParams()
+		if len(st.binds) != 0 || len(st.chunked) != 0 {
+			t.Fatal("expected the bound parameters to be released")
+		}
+		if _, err = s.Query(nil); err != errParamsReset {
+			t.Fatalf("expected the reset parameters to be reported, got %v", err)
+		}
+		if got := query("c", 2.5); got != "[c 2.5]" {
+			t.Fatalf("unexpected row %v", got)
+		}
+	})
+}
+
+func TestAutocommitReleasesLocks(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxOpenConns(2)
+
+	_, err := db.Exec("CREATE TABLE locked (a INT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE locked")
+	if _, err = db.Exec("INSERT INTO locked VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	reader, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	// serializable reads keep read locks until the end of the transaction
+	if _, err = reader.ExecContext(ctx, "SET TEMPORARY OPTION isolation_level = 3"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := reader.QueryContext(ctx, "SELECT a FROM locked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r.Next() {
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	// fail right away instead of waiting for the lock
+	if _, err = writer.ExecContext(ctx, "SET TEMPORARY OPTION blocking = 'Off'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = writer.ExecContext(ctx, "UPDATE locked SET a = 2"); err != nil {
+		t.Fatalf("expected the read lock to be released after rows.Close: %v", err)
+	}
+}
+
+type upperValuer string
+
+func (v upperValuer) Value() (driver.Value, error) {
+	return strings.ToUpper(string(v)), nil
+}
+
+func TestBindValuer(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		// bypass database/sql argument conversion
+		rs := rawQuery(t, cn, "SELECT CAST(? AS VARCHAR(10))", upperValuer("abc"))
+		defer rs.st.Close()
+
+		dest := make([]driver.Value, 1)
+		if err := rs.Next(dest); err != nil {
+			t.Fatal(err)
+		}
+		if dest[0] != "ABC" {
+			t.Fatalf("expected ABC, got %v", dest[0])
+		}
+	})
+}
+
+type ptrValuer struct {
+	s string
+}
+
+func (v *ptrValuer) Value() (driver.Value, error) {
+	return "ptr:" + v.s, nil
+}
+
+func TestBindPointerValuer(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	var s string
+	if err := db.QueryRow("SELECT CAST(? AS VARCHAR(10))", &ptrValuer{"abc"}).Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "ptr:abc" {
+		t.Fatalf("expected ptr:abc, got %q", s)
+	}
+}
+
+type testStatus string
+
+const testStatusActive testStatus = "active"
+
+func TestBindPointer(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE #ptr (id INT, n INT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	n := 42
+	if _, err := db.Exec("INSERT INTO #ptr VALUES (1, ?), (2, ?)", (*int)(nil), &n); err != nil {
+		t.Fatal(err)
+	}
+	var got sql.NullInt64
+	if err := db.QueryRow("SELECT n FROM #ptr WHERE id = 1").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Valid {
+		t.Fatalf("expected NULL, got %d", got.Int64)
+	}
+	if err := db.QueryRow("SELECT n FROM #ptr WHERE id = 2").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Valid || got.Int64 != 42 {
+		t.Fatalf("expected 42, got %v", got)
+	}
+
+	// passed to the driver directly
+	withConn(t, db, func(cn *conn) {
+		f := float32(1.5)
+		rs := rawQuery(t, cn, "SELECT ?, ?", (*string)(nil), &f)
+		defer rs.Close()
+		dest := make([]driver.Value, 2)
+		if err := rs.Next(dest); err != nil {
+			t.Fatal(err)
+		}
+		if dest[0] != nil || fmt.Sprint(dest[1]) != "1.5" {
+			t.Fatalf("expected [<nil> 1.5], got %v", dest)
+		}
+	})
+}
+
+func TestBindNamedString(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #status (s VARCHAR(10))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("INSERT INTO #status VALUES (?)", testStatusActive); err != nil {
+		t.Fatal(err)
+	}
+	var s testStatus
+	if err = db.QueryRow("SELECT s FROM #status").Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != testStatusActive {
+		t.Fatalf("expected %q, got %q", testStatusActive, s)
+	}
+
+	withConn(t, db, func(cn *conn) {
+		// bypass database/sql argument conversion
+		rs := rawQuery(t, cn, "SELECT count(*) FROM #status WHERE s = ?", testStatusActive)
+		defer rs.st.Close()
+
+		dest := make([]driver.Value, 1)
+		if err := rs.Next(dest); err != nil {
+			t.Fatal(err)
+		}
+		if n := fmt.Sprint(dest[0]); n != "1" {
+			t.Fatalf("expected 1 matching row, got %s", n)
+		}
+	})
+}
+
+func TestFetchBufferSize(t *testing.T) {
+	for _, size := range []string{"256", "64KB"} {
+		db, err := sql.Open("sqlany", testDSN+";fetch_buffer_size="+size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		_, err = db.Exec("CREATE TABLE #wide (id INT, s VARCHAR(32000))")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// alternate short and long values so buffers are both reused and grown
+		lengths := []int{10, 30000, 1, 1000, 32000}
+		for i, n := range lengths {
+			if _, err = db.Exec("INSERT INTO #wide VALUES (?, ?)", i, strings.Repeat("x", n)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r, err := db.Query("SELECT id, s FROM #wide ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for r.Next() {
+			var id int
+			var s string
+			if err = r.Scan(&id, &s); err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.Repeat("x", lengths[id]); s != want {
+				t.Fatalf("fetch_buffer_size=%s: row %d: expected %d bytes, got %d", size, id, len(want), len(s))
+			}
+		}
+		if err = r.Err(); err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT 1 AS id, 'x' AS name, 2 AS Id")
+		defer rs.st.Close()
+
+		for name, want := range map[string]int{"id": 0, "ID": 0, "name": 1} {
+			i, ok := rs.ColumnIndex(name)
+			if !ok || i != want {
+				t.Errorf("%s: expected column %d, got %d (found: %t)", name, want, i, ok)
+			}
+		}
+		if _, ok := rs.ColumnIndex("missing"); ok {
+			t.Error("expected missing column not to be found")
+		}
+	})
+}
+
+func TestBindFloat32(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #real (r REAL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := float32(1.1)
+	if _, err = db.Exec("INSERT INTO #real VALUES (?)", want); err != nil {
+		t.Fatal(err)
+	}
+
+	var got float32
+	if err = db.QueryRow("SELECT r FROM #real").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	// the stored value must be the float32 and not a widened approximation
+	var exact int
+	if err = db.QueryRow("SELECT count(*) FROM #real WHERE r = CAST(1.1 AS REAL)").Scan(&exact); err != nil {
+		t.Fatal(err)
+	}
+	if exact != 1 {
+		t.Fatal("expected the stored value to equal CAST(1.1 AS REAL)")
+	}
+}
+
+func TestScanInterfaceTypes(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE #rich (ts TIMESTAMP, d DECIMAL(10,2), b BIT)"); err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2020, 5, 17, 10, 30, 15, 0, time.UTC)
+	if _, err := db.Exec("INSERT INTO #rich VALUES (?, ?, ?)", ts, "12.50", true); err != nil {
+		t.Fatal(err)
+	}
+	var tv, dv, bv interface{}
+	if err := db.QueryRow("SELECT ts, d, b FROM #rich").Scan(&tv, &dv, &bv); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := tv.(time.Time); !ok || !v.Equal(ts) {
+		t.Fatalf("expected the TIMESTAMP as time.Time %v, got %#v", ts, tv)
+	}
+	// exact text rather than a float64
+	if v, ok := dv.(string); !ok || v != "12.50" {
+		t.Fatalf("expected the DECIMAL as string 12.50, got %#v", dv)
+	}
+	if v, ok := bv.(uint8); !ok || v != 1 {
+		t.Fatalf("expected the BIT as uint8 1, got %#v", bv)
+	}
+	var n int
+	if err := db.QueryRow("SELECT b FROM #rich").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected the BIT to scan into an int, got %d (%v)", n, err)
+	}
+
+	bdb, err := sql.Open(DriverName, testDSN+";bit_as_bool=yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+	if err = bdb.QueryRow("SELECT CAST(1 AS BIT)").Scan(&bv); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := bv.(bool); !ok || !v {
+		t.Fatalf("expected the BIT as bool true with bit_as_bool, got %#v", bv)
+	}
+}
+
+func TestScanFloatTypes(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE #floats (r REAL, f FLOAT(10), d DOUBLE)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO #floats VALUES (?, ?, ?)", float32(0.1), float32(2.5), 0.1); err != nil {
+		t.Fatal(err)
+	}
+	var r, f float32
+	var d float64
+	if err := db.QueryRow("SELECT r, f, d FROM #floats").Scan(&r, &f, &d); err != nil {
+		t.Fatal(err)
+	}
+	if r != float32(0.1) || f != 2.5 || d != 0.1 {
+		t.Fatalf("expected 0.1, 2.5 and 0.1, got %v, %v and %v", r, f, d)
+	}
+
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT r, d FROM #floats")
+		defer rs.st.Close()
+		if rs.meta[0].GoType != reflect.TypeOf(float32(0)) || rs.meta[1].GoType != reflect.TypeOf(float64(0)) {
+			t.Fatalf("expected float32 and float64, got %v and %v", rs.meta[0].GoType, rs.meta[1].GoType)
+		}
+		dest := make([]driver.Value, 2)
+		if err := rs.Next(dest); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := dest[0].(float32); !ok {
+			t.Fatalf("expected REAL to be read as float32, got %T", dest[0])
+		}
+		if _, ok := dest[1].(float64); !ok {
+			t.Fatalf("expected DOUBLE to be read as float64, got %T", dest[1])
+		}
+	})
+}
+
+func TestFetchAt(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT row_num FROM sa_rowgenerator(1, 5) ORDER BY row_num")
+		defer rs.st.Close()
+
+		ok, err := rs.FetchAt(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatal("expected a row at position 3")
+		}
+		dest := make([]driver.Value, 1)
+		for _, want := range []string{"3", "4"} {
+			if err = rs.Next(dest); err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(dest[0]); got != want {
+				t.Fatalf("expected row %s, got %s", want, got)
+			}
+		}
+
+		if ok, err = rs.FetchAt(10); err != nil || ok {
+			t.Fatalf("expected no row at position 10, got %t, %v", ok, err)
+		}
+	})
+}
+
+func TestFetchAtForwardOnly(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT row_num FROM sa_rowgenerator(1, 5) ORDER BY row_num")
+		defer rs.st.Close()
+		defer rs.Close()
+
+		rs.st.forwardOnly = true
+		if ok, err := rs.FetchAt(3); ok || err != ErrForwardOnly {
+			t.Fatalf("expected ErrForwardOnly, got %t, %v", ok, err)
+		}
+		// iteration carries on from the start
+		dest := make([]driver.Value, 1)
+		if err := rs.Next(dest); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(dest[0]); got != "1" {
+			t.Fatalf("expected row 1, got %s", got)
+		}
+	})
+}
+
+func TestRowsPosition(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT row_num FROM sa_rowgenerator(1, 5) ORDER BY row_num")
+		defer rs.st.Close()
+
+		dest := make([]driver.Value, 1)
+		for want := int64(1); want <= 3; want++ {
+			if err := rs.Next(dest); err != nil {
+				t.Fatal(err)
+			}
+			if pos, ok := rs.Position(); !ok || pos != want {
+				t.Fatalf("expected position %d, got %d (%t)", want, pos, ok)
+			}
+		}
+		if _, err := rs.FetchAt(2); err != nil {
+			t.Fatal(err)
+		}
+		if err := rs.Next(dest); err != nil {
+			t.Fatal(err)
+		}
+		if pos, ok := rs.Position(); !ok || pos != 2 {
+			t.Fatalf("expected position 2 after FetchAt, got %d (%t)", pos, ok)
+		}
+	})
+
+	db = openCursorConn(t, CursorFastForwardReadOnly)
+	defer db.Close()
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT row_num FROM sa_rowgenerator(1, 5)")
+		defer rs.st.Close()
+		dest := make([]driver.Value, 1)
+		for i := 0; i < 2; i++ {
+			if err := rs.Next(dest); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if pos, ok := rs.Position(); !ok || pos != 2 {
+			t.Fatalf("expected position 2 for a forward-only cursor, got %d (%t)", pos, ok)
+		}
+	})
+}
+
+func TestRawColumn(t *testing.T) {
+	const query = "SELECT 'Gr' || NCHAR(252) || NCHAR(223) || 'e', CAST(258 AS INT), NULL"
+	for _, c := range []struct {
+		charset string
+		want    []byte
+	}{
+		{"utf8", []byte("Grüße")},
+		{"cp1252", []byte{'G', 'r', 0xfc, 0xdf, 'e'}},
+	} {
+		dc, err := (&drv{}).Open(testDSN + ";charset=" + c.charset + ";raw_column_dump=yes")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs := rawQuery(t, dc.(*conn), query)
+		row := make([]driver.Value, 3)
+		if err = rs.Next(row); err != nil {
+			t.Fatal(err)
+		}
+		if raw := rs.RawColumn(0); !bytes.Equal(raw, c.want) {
+			t.Errorf("%s: expected % x, got % x", c.charset, c.want, raw)
+		}
+		if raw := rs.RawColumn(1); !bytes.Equal(raw, []byte{2, 1, 0, 0}) {
+			t.Errorf("%s: expected the little-endian integer, got % x", c.charset, raw)
+		}
+		if rs.RawColumn(2) != nil || rs.RawColumn(3) != nil {
+			t.Errorf("%s: expected no bytes for NULL and out of range columns", c.charset)
+		}
+		rs.Close()
+		rs.st.Close()
+		dc.Close()
+	}
+
+	// nothing is kept by default
+	db := openTestConn(t)
+	defer db.Close()
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, query)
+		defer rs.st.Close()
+		defer rs.Close()
+		row := make([]driver.Value, 3)
+		if err := rs.Next(row); err != nil {
+			t.Fatal(err)
+		}
+		if rs.raw != nil || rs.RawColumn(0) != nil {
+			t.Fatal("expected no raw column dump")
+		}
+	})
+}
+
+func TestEstimatedRows(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE #est (a INT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO #est SELECT row_num FROM sa_rowgenerator(1, 100)"); err != nil {
+		t.Fatal(err)
+	}
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT a FROM #est")
+		defer rs.st.Close()
+		if n := rs.EstimatedRows(); n < 0 {
+			t.Fatalf("expected a row estimate, got %d", n)
+		}
+	})
+}
+
+func TestBindTimeLocation(t *testing.T) {
+	ts := time.Date(2013, 5, 6, 1, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	for _, c := range []struct {
+		location string
+		date     string
+	}{
+		{"", "2013-05-05"},
+		{"Europe/Berlin", "2013-05-06"},
+	} {
+		dsn := testDSN
+		if c.location != "" {
+			dsn += ";location=" + c.location
+		}
+		db, err := sql.Open(DriverName, dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		if _, err = db.Exec("CREATE TABLE #located (d DATE, ts TIMESTAMP)"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = db.Exec("INSERT INTO #located VALUES (?, ?)", ts, ts); err != nil {
+			t.Fatal(err)
+		}
+		var date string
+		var read time.Time
+		if err = db.QueryRow("SELECT CAST(d AS VARCHAR(30)), ts FROM #located").Scan(&date, &read); err != nil {
+			t.Fatal(err)
+		}
+		if date != c.date {
+			t.Errorf("%q: expected the date %s, got %s", c.location, c.date, date)
+		}
+		if !read.Equal(ts) {
+			t.Errorf("%q: expected %v, got %v", c.location, ts, read)
+		}
+		db.Close()
+	}
+}
+
+func TestInlineTimeLocation(t *testing.T) {
+	db, err := sql.Open(DriverName, testDSN+";location=Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ts := time.Date(2013, 5, 6, 1, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	withConn(t, db, func(cn *conn) {
+		ctx := context.Background()
+		const query = "SELECT CAST(CAST(? AS TIMESTAMP) AS VARCHAR(30))"
+		bound, err := cn.Scalar(ctx, query, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inlined, err := inlineArgs(query, []interface{}{ts}, cn.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lit, err := cn.Scalar(ctx, inlined)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bound != lit {
+			t.Fatalf("expected the inlined value %v to equal the bound one %v", lit, bound)
+		}
+	})
+}
+
+func TestBindTimeToDate(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #dates (d DATE)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2013, 5, 6, 13, 14, 15, 16000, time.UTC)
+	if _, err = db.Exec("INSERT INTO #dates VALUES (?)", ts); err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	if err = db.QueryRow("SELECT CAST(d AS VARCHAR(30)) FROM #dates").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != "2013-05-06" {
+		t.Fatalf("expected the date only to be stored, got %q", got)
+	}
+}
+
+func TestBindTimeOfDay(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE #times (id INT, t TIME)"); err != nil {
+		t.Fatal(err)
+	}
+	tod := TimeOfDay(13*time.Hour + 45*time.Minute + 30*time.Second + 500*time.Millisecond)
+	if _, err := db.Exec("INSERT INTO #times VALUES (1, ?)", tod); err != nil {
+		t.Fatal(err)
+	}
+	var read time.Time
+	if err := db.QueryRow("SELECT t FROM #times WHERE id = 1").Scan(&read); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(0, 1, 1, 13, 45, 30, 500e6, time.UTC); !read.Equal(want) {
+		t.Fatalf("expected %v, got %v", want, read)
+	}
+
+	// a time.Time read from a TIME column binds as a time of day once
+	// converted explicitly
+	var again TimeOfDay
+	if err := again.Scan(read); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO #times VALUES (2, ?)", again); err != nil {
+		t.Fatal(err)
+	}
+	var back TimeOfDay
+	if err := db.QueryRow("SELECT t FROM #times WHERE id = 2").Scan(&back); err != nil {
+		t.Fatal(err)
+	}
+	if back != tod {
+		t.Fatalf("expected %v, got %v", time.Duration(tod), time.Duration(back))
+	}
+}
+
+func TestTimestampFormat(t *testing.T) {
+	const layout = "2006-01-02T15:04:05"
+	cfg, err := ParseDSN(testDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.TimestampFormat = layout
+	c, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE #tsfmt (s VARCHAR(40))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2013, 5, 6, 13, 14, 15, 0, time.UTC)
+	if _, err = db.Exec("INSERT INTO #tsfmt VALUES (?)", ts); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err = db.QueryRow("SELECT s FROM #tsfmt").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if want := ts.Format(layout); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	cfg.TimestampFormat = "2006-01-02"
+	if _, err = open(context.Background(), cfg, nil); err == nil {
+		t.Fatal("expected a format dropping the time of day to be rejected")
+	}
+}
+
+func TestDateOrder(t *testing.T) {
+	cfg, err := ParseDSN(testDSN + ";date_order=MDY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	defer db.Close()
+
+	var d time.Time
+	if err = db.QueryRow("SELECT CAST('01/02/2020' AS DATE)").Scan(&d); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC); !d.Equal(want) {
+		t.Fatalf("expected %v, got %v", want, d)
+	}
+
+	cfg.DateOrder = "DYM"
+	if _, err = open(context.Background(), cfg, nil); err == nil {
+		t.Fatal("expected an unknown date order to be rejected")
+	}
+	cfg.DateOrder, cfg.DateFormat = "", "YYYY-MM-DD HH:NN"
+	if _, err = open(context.Background(), cfg, nil); err == nil {
+		t.Fatal("expected a date format with a time of day to be rejected")
+	}
+}
+
+func TestScanNullTime(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	var nt sql.NullTime
+	if err := db.QueryRow("SELECT CAST(NULL AS TIMESTAMP)").Scan(&nt); err != nil {
+		t.Fatal(err)
+	}
+	if nt.Valid {
+		t.Fatalf("expected NULL, got %v", nt.Time)
+	}
+
+	want := time.Date(2013, 5, 6, 13, 14, 15, 16000000, time.UTC)
+	if err := db.QueryRow("SELECT CAST('2013-05-06 13:14:15.016' AS TIMESTAMP)").Scan(&nt); err != nil {
+		t.Fatal(err)
+	}
+	if !nt.Valid || !nt.Time.Equal(want) {
+		t.Fatalf("expected %v, got %v (valid: %t)", want, nt.Time, nt.Valid)
+	}
+
+	var d time.Time
+	if err := db.QueryRow("SELECT CAST('2013-05-06' AS DATE)").Scan(&d); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Equal(time.Date(2013, 5, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected date %v", d)
+	}
+}
+
+func TestZeroTimeAsNull(t *testing.T) {
+	cfg, err := ParseDSN(testDSN + ";zero_time_as_null=yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE #zt (a TIMESTAMP NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("INSERT INTO #zt VALUES (?)", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	var a sql.NullString
+	if err = db.QueryRow("SELECT a FROM #zt").Scan(&a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Valid {
+		t.Fatalf("expected NULL, got %q", a.String)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxIdleConns(4)
+
+	if err := Warmup(context.Background(), db, 4); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.Stats().OpenConnections; n != 4 {
+		t.Fatalf("expected 4 open connections, got %d", n)
+	}
+
+	// capped by the maximum number of open connections
+	db2 := openTestConn(t)
+	defer db2.Close()
+	db2.SetMaxOpenConns(2)
+	if err := Warmup(context.Background(), db2, 4); err != nil {
+		t.Fatal(err)
+	}
+	if n := db2.Stats().OpenConnections; n != 2 {
+		t.Fatalf("expected 2 open connections, got %d", n)
+	}
+
+	// nothing to do for a non-positive count
+	for _, n := range []int{0, -1} {
+		if err := Warmup(context.Background(), db2, n); err != nil {
+			t.Fatalf("%d: %v", n, err)
+		}
+	}
+}
+
+func TestInsertedRow(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec(`CREATE TABLE inserted (id INT DEFAULT AUTOINCREMENT PRIMARY KEY,
+		name VARCHAR(20), status VARCHAR(10) DEFAULT 'new')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE inserted")
+
+	withConn(t, db, func(cn *conn) {
+		s, err := cn.Prepare("INSERT INTO inserted (name) VALUES (?)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		st := s.(*stmt)
+		defer st.Close()
+
+		for i := 1; i <= 2; i++ {
+			if _, err = st.Exec([]driver.Value{"bob"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		row, err := st.InsertedRow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := fmt.Sprint(row["id"]); id != "2" {
+			t.Errorf("expected id 2, got %s", id)
+		}
+		if row["name"] != "bob" || row["status"] != "new" {
+			t.Errorf("unexpected row %v", row)
+		}
+	})
+}
+
+func TestLastInsertId(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		err   error
+	}{
+		{"", nil},
+		{"SELECT no_such_identity()", ErrNotSupported},
+		{"SELECT NULL", ErrNotSupported},
+	} {
+		cfg, err := ParseDSN(testDSN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.IdentityQuery = tc.query
+		c, err := NewConnector(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := sql.OpenDB(c)
+		db.SetMaxOpenConns(1)
+		if _, err = db.Exec("CREATE TABLE #ident (id INT DEFAULT AUTOINCREMENT PRIMARY KEY, a INT)"); err != nil {
+			t.Fatal(err)
+		}
+		res, err := db.Exec("INSERT INTO #ident (a) VALUES (1)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := res.LastInsertId()
+		if err != tc.err {
+			t.Fatalf("%q: expected %v, got %v", tc.query, tc.err, err)
+		}
+		if err == nil && id != 1 {
+			t.Fatalf("expected id 1, got %d", id)
+		}
+		db.Close()
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE readonly (a INT)"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE readonly")
+
+	ro, err := sql.Open(DriverName, testDSN+";readonly=yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	var n int
+	if err = ro.QueryRow("SELECT count(*) FROM readonly").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ro.Exec("INSERT INTO readonly VALUES (1)"); err != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+}
+
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Print(v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprint(v...))
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	cfg, err := ParseDSN(testDSN + ";slow_query_threshold=10ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := &testLogger{}
+	cfg.Logger = logger
+	c, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	defer db.Close()
+
+	if _, err = db.Exec("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	const query = "WAITFOR DELAY '00:00:00.100'"
+	if _, err = db.Exec(query); err != nil {
+		t.Fatal(err)
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], query) {
+		t.Fatalf("expected the slow query to be logged, got %q", logger.lines)
+	}
+}
+
+func TestDebugBindBuffers(t *testing.T) {
+	cfg, err := ParseDSN(testDSN + ";debug_bind_buffers=yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := &testLogger{}
+	cfg.Logger = logger
+	c, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	defer db.Close()
+
+	var s string
+	if err = db.QueryRow("SELECT ? || CAST(? AS VARCHAR(10)) || ?", "a", 1, 2.5).Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	var bound, released int
+	for _, line := range logger.lines {
+		if !strings.HasPrefix(line, "sqla: bind buffer ") {
+			continue
+		}
+		if strings.Contains(line, " released after ") {
+			released++
+		} else {
+			bound++
+		}
+	}
+	if bound != 3 || released != 3 {
+		t.Fatalf("expected 3 bind buffers bound and released, got %q", logger.lines)
+	}
+}
+
+func TestProcedureOutParamsOnly(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec(`CREATE PROCEDURE outonly(IN a INT, OUT b INT, OUT c VARCHAR(20))
+		BEGIN
+			SET b = a * 2;
+			SET c = 'done'
+		END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP PROCEDURE outonly")
+
+	var b int
+	var c string
+	r, err := db.Query("CALL outonly(?, ?, ?)", 21, sql.Out{Dest: &b}, sql.Out{Dest: &c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Next() {
+		t.Fatal("unexpected row")
+	}
+	if err = r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if r.NextResultSet() {
+		t.Fatal("unexpected result set")
+	}
+	r.Close()
+	if b != 42 || c != "done" {
+		t.Fatalf("expected 42 and done, got %d and %q", b, c)
+	}
+
+	b, c = 0, ""
+	if _, err = db.Exec("CALL outonly(?, ?, ?)", 5, sql.Out{Dest: &b}, sql.Out{Dest: &c}); err != nil {
+		t.Fatal(err)
+	}
+	if b != 10 || c != "done" {
+		t.Fatalf("expected 10 and done, got %d and %q", b, c)
+	}
+}
+
+func TestProcedureRowsThenOutParams(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec(`CREATE PROCEDURE rowsandout(IN n INT, OUT cnt INT)
+		RESULT (i INT)
+		BEGIN
+			SET cnt = n;
+			SELECT row_num FROM sa_rowgenerator(1, n)
+		END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP PROCEDURE rowsandout")
+
+	cnt := -1
+	r, err := db.Query("CALL rowsandout(?, ?)", 3, sql.Out{Dest: &cnt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var n int
+	for r.Next() {
+		var i int
+		if err = r.Scan(&i); err != nil {
+			t.Fatal(err)
+		}
+		if cnt != -1 {
+			t.Fatalf("output parameter assigned before the rows were consumed: %d", cnt)
+		}
+		n++
+	}
+	if err = r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 rows, got %d", n)
+	}
+	if cnt != 3 {
+		t.Fatalf("expected an output count of 3, got %d", cnt)
+	}
+}
+
+func TestColumnsNextResultSet(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec(`CREATE PROCEDURE tworesults()
+		BEGIN
+			SELECT 1 AS a;
+			SELECT 1 AS a, 2 AS b, 3 AS c
+		END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP PROCEDURE tworesults")
+
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "CALL tworesults()")
+		defer rs.st.Close()
+		defer rs.Close()
+
+		if n := rs.NumColumns(); n != 1 || !reflect.DeepEqual(rs.Columns(), []string{"a"}) {
+			t.Fatalf("expected a single column, got %v", rs.Columns())
+		}
+		dest := make([]driver.Value, rs.NumColumns())
+		for rs.Next(dest) == nil {
+		}
+		if err := rs.NextResultSet(); err != nil {
+			t.Fatal(err)
+		}
+		if n := rs.NumColumns(); n != 3 || !reflect.DeepEqual(rs.Columns(), []string{"a", "b", "c"}) {
+			t.Fatalf("expected three columns, got %v", rs.Columns())
+		}
+		dest = make([]driver.Value, rs.NumColumns())
+		if err := rs.Next(dest); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(dest) != "[1 2 3]" {
+			t.Fatalf("unexpected row %v", dest)
+		}
+	})
+}
+
+func TestGeometryWKB(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #geo (g ST_Point)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// POINT(1 2), little endian
+	want := Geometry{0x01, 0x01, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x3f,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40}
+	if _, err = db.Exec("INSERT INTO #geo VALUES (?)", want); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Geometry
+	if err = db.QueryRow("SELECT g FROM #geo").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected %x, got %x", want, got)
+	}
+}
+
+func TestCheckConnection(t *testing.T) {
+	c, err := (&drv{}).Open(testDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn := c.(*conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = cn.CheckConnection(ctx); err != nil {
+		t.Fatalf("expected a live connection, got %v", err)
+	}
+
+	cn.Close()
+	if err = cn.CheckConnection(ctx); err == nil {
+		t.Fatal("expected an error for a closed connection")
+	}
+}
+
+type stubEventSource struct {
+	events chan Event
+}
+
+func (src *stubEventSource) next() (Event, error) {
+	ev, ok := <-src.events
+	if !ok {
+		return Event{}, errEventsClosed
+	}
+	return ev, nil
+}
+
+func (src *stubEventSource) id() int {
+	return 1
+}
+
+func (src *stubEventSource) interrupt() {
+	close(src.events)
+}
+
+func (src *stubEventSource) close() error {
+	return nil
+}
+
+func TestSubscribe(t *testing.T) {
+	src := &stubEventSource{events: make(chan Event)}
+	saved := newEventSource
+	newEventSource = func(*Config) (eventSource, error) { return src, nil }
+	defer func() { newEventSource = saved }()
+
+	c, err := (&drv{}).Open(testDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn := c.(*conn)
+
+	orders, err := cn.Subscribe("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cn.Subscribe("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src.events <- Event{Name: "orders", Payload: "42"}
+	select {
+	case ev := <-orders:
+		if ev.Payload != "42" {
+			t.Fatalf("expected payload 42, got %q", ev.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not delivered")
+	}
+
+	cn.Close()
+	if _, ok := <-other; ok {
+		t.Fatal("expected no events for other subscriptions")
+	}
+	if _, ok := <-orders; ok {
+		t.Fatal("expected the channel to be closed with the connection")
+	}
+}
+
+func TestBindInt64Decimal(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #dec (a DECIMAL(20,0), b BIGINT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = int64(9223372036854775807)
+	if _, err = db.Exec("INSERT INTO #dec VALUES (?, ?)", want, want); err != nil {
+		t.Fatal(err)
+	}
+	var a string
+	var b int64
+	if err = db.QueryRow("SELECT a, b FROM #dec").Scan(&a, &b); err != nil {
+		t.Fatal(err)
+	}
+	if a != "9223372036854775807" {
+		t.Fatalf("expected %d in the DECIMAL column, got %s", want, a)
+	}
+	if b != want {
+		t.Fatalf("expected %d in the BIGINT column, got %d", want, b)
+	}
+}
+
+func TestMaxParams(t *testing.T) {
+	db, err := sql.Open(DriverName, testDSN+";max_params=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow("SELECT ? + ? + ? + ?", 1, 2, 3, 4).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Fatalf("expected 10, got %d", n)
+	}
+	_, err = db.Exec("SELECT ? + ? + ? + ? + ?", 1, 2, 3, 4, 5)
+	if err == nil || !strings.Contains(err.Error(), "more than the limit of 4") {
+		t.Fatalf("expected the parameter limit to be exceeded, got %v", err)
+	}
+}
+
+func openStmtCacheConn(t Fataler, size int) *sql.DB {
+	cfg, err := ParseDSN(fmt.Sprintf("%s;stmt_cache=%d", testDSN, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestStmtCache(t *testing.T) {
+	db := openStmtCacheConn(t, 2)
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var n int
+		if err := db.QueryRow("SELECT ? + 1", i).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != i+1 {
+			t.Fatalf("expected %d, got %d", i+1, n)
+		}
+	}
+	withConn(t, db, func(cn *conn) {
+		if cn.stmts.misses != 1 || cn.stmts.hits != 9 {
+			t.Fatalf("expected 1 prepare and 9 cache hits, got %d and %d",
+				cn.stmts.misses, cn.stmts.hits)
+		}
+	})
+
+	// evicts the least recently used statements
+	for _, q := range []string{"SELECT 1", "SELECT 2", "SELECT 3"} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	withConn(t, db, func(cn *conn) {
+		if n := cn.stmts.lru.Len(); n != 2 {
+			t.Fatalf("expected 2 cached statements, got %d", n)
+		}
+		if _, ok := cn.stmts.stmts["SELECT ? + 1"]; ok {
+			t.Fatal("expected the least recently used statement to be evicted")
+		}
+	})
+}
+
+func TestStmtCacheShared(t *testing.T) {
+	cfg, err := ParseDSN(testDSN + ";stmt_cache=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	defer db.Close()
+	// a new connection for each query
+	db.SetMaxIdleConns(0)
+
+	for i := 0; i < 3; i++ {
+		var n int
+		if err = db.QueryRow("SELECT ? + 1 AS n", i).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != i+1 {
+			t.Fatalf("expected %d, got %d", i+1, n)
+		}
+	}
+	meta := c.(*connector).meta
+	if meta.misses != 1 || meta.hits != 2 {
+		t.Fatalf("expected the query to be described once and reused twice, got %d and %d",
+			meta.misses, meta.hits)
+	}
+}
+
+func TestStmtEvictCallback(t *testing.T) {
+	cfg, err := ParseDSN(testDSN + ";stmt_cache=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var evicted []string
+	cfg.OnStmtEvict = func(query string) {
+		evicted = append(evicted, query)
+	}
+	c, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	for _, q := range []string{"SELECT 1", "SELECT 2", "SELECT 1", "SELECT 3", "SELECT 4"} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// SELECT 1 has been used after SELECT 2 so it is evicted last
+	if want := []string{"SELECT 2", "SELECT 1"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("expected %q to be evicted, got %q", want, evicted)
+	}
+}
+
+func benchmarkQueryRow(b *testing.B, db *sql.DB) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM sys.systable WHERE table_id > ?", i).Scan(&n); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQueryRow(b *testing.B) {
+	db := openStmtCacheConn(b, 0)
+	defer db.Close()
+	benchmarkQueryRow(b, db)
+}
+
+func BenchmarkQueryRowStmtCache(b *testing.B) {
+	db := openStmtCacheConn(b, 16)
+	defer db.Close()
+	benchmarkQueryRow(b, db)
+}
+
+func TestRegisteredConverter(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #conv (a VARCHAR(10), b INT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("INSERT INTO #conv VALUES ('abc', 1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	RegisterConverter(DT_VARCHAR, func(b []byte) (driver.Value, error) {
+		calls++
+		return strings.ToUpper(string(b)), nil
+	})
+	defer RegisterConverter(DT_VARCHAR, nil)
+
+	var a string
+	var b int
+	if err = db.QueryRow("SELECT a, b FROM #conv").Scan(&a, &b); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected the converter to be invoked once, got %d", calls)
+	}
+	if a != "ABC" || b != 1 {
+		t.Fatalf("expected ABC and 1, got %q and %d", a, b)
+	}
+}
+
+func TestSqlxNamedExec(t *testing.T) {
+	if BindType != sqlx.QUESTION {
+		t.Fatalf("expected the sqlx.QUESTION bind type, got %d", BindType)
+	}
+	sqlx.BindDriver(DriverName, BindType)
+	db, err := sqlx.Open(DriverName, testDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // the temporary table is local to the connection
+
+	if _, err = db.Exec("CREATE TABLE #named (id INT, name VARCHAR(20))"); err != nil {
+		t.Fatal(err)
+	}
+	type row struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	want := row{ID: 1, Name: "one"}
+	if _, err = db.NamedExec("INSERT INTO #named (id, name) VALUES (:id, :name)", want); err != nil {
+		t.Fatal(err)
+	}
+	var got row
+	if err = db.Get(&got, "SELECT id, name FROM #named WHERE id = ?", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+// stands in for a decimal type such as shopspring/decimal.Decimal
+type testDecimal struct {
+	text string
+}
+
+func (d *testDecimal) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		d.text = v
+	case []byte:
+		d.text = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a decimal", src)
+	}
+	return nil
+}
+
+func TestScanDecimal(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #decimal (a DECIMAL(18,6))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("INSERT INTO #decimal VALUES (?)", "123456789012.345678"); err != nil {
+		t.Fatal(err)
+	}
+	var d testDecimal
+	if err = db.QueryRow("SELECT a FROM #decimal").Scan(&d); err != nil {
+		t.Fatal(err)
+	}
+	if d.text != "123456789012.345678" {
+		t.Fatalf("expected the exact value, got %q", d.text)
+	}
+}
+
+func TestDecimalAsFloat(t *testing.T) {
+	for _, tc := range []struct {
+		rounding string
+		want     float64
+	}{
+		{"round", 12345678901234568},
+		{"truncate", 12345678901234566},
+	} {
+		db, err := sql.Open(DriverName, testDSN+";decimal_as=float;decimal_rounding="+tc.rounding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v interface{}
+		if err = db.QueryRow("SELECT CAST('12345678901234567.89' AS DECIMAL(30,2))").Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		if f, ok := v.(float64); !ok || f != tc.want {
+			t.Fatalf("expected %f with %s, got %#v", tc.want, tc.rounding, v)
+		}
+		db.Close()
+	}
+}
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	query := "SELECT 1\nFROM dummy\nWHERE 1 = )"
+	_, err := db.Prepare(query)
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	var pos ErrorPosition
+	if !errors.As(err, &pos) {
+		t.Fatalf("expected the error to report a position, got %T", err)
+	}
+	if pos.Line() != 3 || pos.Column() == 0 || pos.Offset() == 0 {
+		t.Fatalf("expected a position on line 3, got %d:%d (offset %d) for %v",
+			pos.Line(), pos.Column(), pos.Offset(), err)
+	}
+	if !strings.HasPrefix(query[pos.Offset()-1:], ")") {
+		t.Fatalf("expected the offset to point at the offending token, got %q", query[pos.Offset()-1:])
+	}
+
+	if _, err = db.Prepare("SELECT 1 FROM no_such_table"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if errors.As(err, &pos) && (pos.Line() != 0 || pos.Column() != 0) {
+		t.Fatalf("expected no position for %v", err)
+	}
+}
+
+func TestQuoteRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	for _, s := range []string{"", "it's", `a\nb \x41`, `"quoted"`, "line\nbreak"} {
+		var got string
+		err := db.QueryRow(fmt.Sprintf("SELECT %s AS %s", QuoteLiteral(s), QuoteIdentifier(`col "x"`))).Scan(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != s {
+			t.Errorf("expected %q, got %q", s, got)
+		}
+	}
+}
+
+func TestExecScript(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		ctx := context.Background()
+		err := cn.ExecScript(ctx, `
+			CREATE TABLE #script (a INT, b VARCHAR(10));
+			INSERT INTO #script VALUES (1, 'one;');
+			INSERT INTO #script VALUES (2, 'two');
+		`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := cn.Scalar(ctx, "SELECT count(*) FROM #script")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := fmt.Sprint(v); s != "2" {
+			t.Fatalf("expected 2 rows, got %s", s)
+		}
+
+		err = cn.ExecScript(ctx, "INSERT INTO #script VALUES (3, 'three'); INSERT INTO #nosuchtable VALUES (1)")
+		var serr *ScriptError
+		if !errors.As(err, &serr) || serr.Index != 1 {
+			t.Fatalf("expected the second statement to fail, got %v", err)
+		}
+	})
+}
+
+func openCursorConn(t Fataler, cursor string) *sql.DB {
+	cfg, err := ParseDSN(testDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Cursor = cursor
+	c, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sql.OpenDB(c)
+}
+
+func TestFastForwardCursor(t *testing.T) {
+	db := openCursorConn(t, CursorFastForwardReadOnly)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT row_num FROM sa_rowgenerator(1, 10) ORDER BY row_num;")
+		defer rs.st.Close()
+		if _, err := rs.FetchAt(5); err != ErrForwardOnly {
+			t.Fatalf("expected ErrForwardOnly, got %v", err)
+		}
+		dest := make([]driver.Value, 1)
+		n := 0
+		for rs.Next(dest) == nil {
+			n++
+		}
+		if n != 10 {
+			t.Fatalf("expected 10 rows, got %d", n)
+		}
+		if err := rs.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func benchmarkScan(b *testing.B, cursor string) {
+	db := openCursorConn(b, cursor)
+	defer db.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, err := db.Query("SELECT row_num, 'some text' FROM sa_rowgenerator(1, 50000)")
+		if err != nil {
+			b.Fatal(err)
+		}
+		var n int
+		var s string
+		for r.Next() {
+			if err = r.Scan(&n, &s); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err = r.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanDefaultCursor(b *testing.B) {
+	benchmarkScan(b, CursorDefault)
+}
+
+func BenchmarkScanFastForwardCursor(b *testing.B) {
+	benchmarkScan(b, CursorFastForwardReadOnly)
+}
+
+func TestWarnings(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #warn (a INT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("INSERT INTO #warn VALUES (1), (NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT sum(a) FROM #warn")
+		defer rs.Close()
+		dest := make([]driver.Value, 1)
+		for rs.Next(dest) == nil {
+		}
+		warnings := rs.Warnings()
+		if len(warnings) == 0 {
+			t.Fatal("expected a warning for the NULL eliminated in the aggregate")
+		}
+		// SQLCODE 109: null value eliminated in aggregate function
+		if warnings[0].Code != 109 {
+			t.Fatalf("unexpected warning %v", warnings[0])
+		}
+
+		st, err := cn.Prepare("UPDATE #warn SET a = 2 WHERE a = 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer st.Close()
+		res, err := st.Exec(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if warnings := res.(*result).Warnings(); len(warnings) != 0 {
+			t.Fatalf("expected no warnings, got %v", warnings)
+		}
+	})
+}
+
+func TestLastSQLCode(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		rs := rawQuery(t, cn, "SELECT sum(a) FROM (SELECT 1 AS a UNION ALL SELECT NULL) t")
+		defer rs.st.Close()
+		if err := rs.Next(make([]driver.Value, 1)); err != nil {
+			t.Fatal(err)
+		}
+		// null value eliminated in aggregate function
+		if code, state := cn.LastSQLCode(); code != 109 || state != "01003" {
+			t.Fatalf("expected SQLCODE 109 (01003), got %d (%s)", code, state)
+		}
+
+		if err := cn.queryRow("SELECT 1", new(int)); err != nil {
+			t.Fatal(err)
+		}
+		if code, state := cn.LastSQLCode(); code != 0 || state != "00000" {
+			t.Fatalf("expected no SQLCODE, got %d (%s)", code, state)
+		}
+	})
+}
+
+// run with -race
+func TestConnConcurrentUse(t *testing.T) {
+	c, err := (&drv{}).Open(testDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn := c.(*conn)
+	defer cn.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				st, err := cn.Prepare("SELECT 1")
+				if err != nil {
+					errs <- err
+					return
+				}
+				st.Close()
+				var name string
+				if err = cn.queryRow("select connection_property('Name')", &name); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	cfg, err := ParseDSN(testDSN + ";retry_idempotent=yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var victim string
+	if err = db.QueryRow("SELECT connection_property('Number')").Scan(&victim); err != nil {
+		t.Fatal(err)
+	}
+	// kill the idle pooled connection behind the back of database/sql
+	admin := openTestConn(t)
+	defer admin.Close()
+	if _, err = admin.Exec("DROP CONNECTION " + victim); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := db.Query("SELECT row_num, connection_property('Number') FROM sa_rowgenerator(1, 3)")
+	if err != nil {
+		t.Fatalf("expected the query to be retried, got %v", err)
+	}
+	defer r.Close()
+	var n int
+	for r.Next() {
+		var i int
+		var number string
+		if err = r.Scan(&i, &number); err != nil {
+			t.Fatal(err)
+		}
+		if number == victim {
+			t.Fatal("expected the query to run on a new connection")
+		}
+		n++
+	}
+	if err = r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 rows, got %d", n)
+	}
+}
+
+func TestArrayTable(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		ctx := context.Background()
+		if err := cn.ExecScript(ctx, "CREATE TABLE #items (id BIGINT); INSERT INTO #items SELECT row_num FROM sa_rowgenerator(1, 10)"); err != nil {
+			t.Fatal(err)
+		}
+		cleanup, err := cn.ArrayTable("ids", []int64{2, 4, 6, 42})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := cn.Scalar(ctx, "SELECT count(*) FROM #items JOIN ids ON #items.id = ids.value")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := fmt.Sprint(v); s != "3" {
+			t.Fatalf("expected 3 matching rows, got %s", s)
+		}
+		cleanup()
+		if _, err = cn.Scalar(ctx, "SELECT count(*) FROM ids"); err == nil {
+			t.Fatal("expected the array table to be dropped")
+		}
+		if _, err = cn.ArrayTable("dba.ids", []int64{1}); err == nil {
+			t.Fatal("expected an owner-qualified array table to be rejected")
+		}
+	})
+}
+
+func TestLoadTableCancel(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE load_items (id INT, name VARCHAR(32))"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE load_items")
+
+	withConn(t, db, func(cn *conn) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var i int
+		n, err := cn.LoadTable(ctx, "load_items", []string{"id", "name"}, func() ([]interface{}, error) {
+			i++
+			if i == 2500 {
+				// abort mid-batch
+				cancel()
+			}
+			return []interface{}{int64(i), fmt.Sprintf("item %d", i)}, nil
+		})
+		if err != context.Canceled {
+			t.Fatalf("expected the load to be canceled, got %v", err)
+		}
+		if n != 2000 {
+			t.Fatalf("expected 2000 rows committed, got %d", n)
+		}
+	})
+
+	// the connection is reused without the rolled back rows or a
+	// pending transaction
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM load_items").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2000 {
+		t.Fatalf("expected 2000 rows, got %d", count)
+	}
+	withConn(t, db, func(cn *conn) {
+		rows := []interface{}{int64(1), "a"}
+		n, err := cn.LoadTable(context.Background(), "load_items", []string{"id", "name"}, func() ([]interface{}, error) {
+			if rows == nil {
+				return nil, io.EOF
+			}
+			defer func() { rows = nil }()
+			return rows, nil
+		})
+		if err != nil || n != 1 {
+			t.Fatalf("expected a single row loaded, got %d (%v)", n, err)
+		}
+	})
+}
+
+func TestLoadTableInt(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE load_big (id BIGINT)"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE load_big")
+
+	// an int is passed to the binder as is rather than as int64
+	const big = 1<<40 + 7
+	withConn(t, db, func(cn *conn) {
+		done := false
+		// qualified with the owner of the table (the test user)
+		n, err := cn.LoadTable(context.Background(), "dba.load_big", []string{"id"}, func() ([]interface{}, error) {
+			if done {
+				return nil, io.EOF
+			}
+			done = true
+			return []interface{}{int(big)}, nil
+		})
+		if err != nil || n != 1 {
+			t.Fatalf("expected a single row loaded, got %d (%v)", n, err)
+		}
+	})
+	var got int64
+	if err := db.QueryRow("SELECT id FROM load_big").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != big {
+		t.Fatalf("expected %d, got %d", int64(big), got)
+	}
+}
+
+func TestExecBatchValidation(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE batch_items (id INT, name VARCHAR(32))"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE batch_items")
+
+	withConn(t, db, func(cn *conn) {
+		const query = "INSERT INTO batch_items (id, name) VALUES (?, ?)"
+		_, err := cn.ExecBatch(context.Background(), query, [][]interface{}{
+			{1, "a"},
+			{"two", "b"},
+			{3, "c"},
+			{4, struct{}{}},
+		})
+		var batchErr *BatchError
+		if !errors.As(err, &batchErr) {
+			t.Fatalf("expected a batch error, got %v", err)
+		}
+		var bad []int
+		for _, row := range batchErr.Rows {
+			bad = append(bad, row.Index)
+		}
+		if fmt.Sprint(bad) != "[1 3]" {
+			t.Fatalf("expected rows 2 and 4 to be reported, got %v", err)
+		}
+		n, err := cn.ExecBatch(context.Background(), query, [][]interface{}{{1, "a"}, {"2", "b"}})
+		if err != nil || n != 2 {
+			t.Fatalf("expected 2 rows inserted, got %d (%v)", n, err)
+		}
+	})
+
+	// nothing of the invalid batch has been sent
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM batch_items").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 rows, got %d", count)
+	}
+}
+
+func TestScanByteArray(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	want := [16]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	var id [16]byte
+	err := db.QueryRow("SELECT CAST(? AS VARBINARY(16))", want).Scan(ByteArray(&id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != want {
+		t.Fatalf("expected %x, got %x", want, id)
+	}
+	var short [8]byte
+	if err = db.QueryRow("SELECT CAST(? AS VARBINARY(16))", want).Scan(ByteArray(&short)); err == nil {
+		t.Fatal("expected an error scanning 16 bytes into [8]byte")
+	}
+}
+
+func TestUnload(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		var buf bytes.Buffer
+		n, err := cn.Unload(context.Background(), "SELECT row_num, 'item ' || row_num AS name FROM sa_rowgenerator(1, 1000)",
+			&buf, UnloadOptions{Delimiter: ";", Header: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(buf.Len()) {
+			t.Fatalf("expected %d bytes written, got %d", buf.Len(), n)
+		}
+		// a variable left behind by a previous call does not clash
+		if err = cn.cn.executeImmediate("CREATE VARIABLE sqla_unload_" + fmt.Sprint(unloadSeq) + " LONG VARCHAR"); err != nil {
+			t.Fatal(err)
+		}
+		var again bytes.Buffer
+		if _, err = cn.Unload(context.Background(), "SELECT 1", &again, UnloadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != 1001 {
+			t.Fatalf("expected a header and 1000 lines, got %d", len(lines))
+		}
+		if lines[0] != `"row_num";"name"` || lines[1] != `1;"item 1"` {
+			t.Fatalf("unexpected lines %q, %q", lines[0], lines[1])
+		}
+	})
+}
+
+func TestUnsigned(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #unsigned (a UNSIGNED SMALLINT, b UNSIGNED INT, c UNSIGNED BIGINT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("INSERT INTO #unsigned VALUES (65535, 4000000000, 18446744073709551615)"); err != nil {
+		t.Fatal(err)
+	}
+	var a uint16
+	var b uint32
+	var c uint64
+	if err = db.QueryRow("SELECT a, b, c FROM #unsigned").Scan(&a, &b, &c); err != nil {
+		t.Fatal(err)
+	}
+	if a != 65535 || b != 4000000000 || c != 18446744073709551615 {
+		t.Fatalf("unexpected unsigned values %d, %d and %d", a, b, c)
+	}
+}
+
+func TestBindUnsigned(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE #ubind (a UNSIGNED SMALLINT, b UNSIGNED INT, c UNSIGNED BIGINT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const max = uint64(18446744073709551615)
+	if _, err = db.Exec("INSERT INTO #ubind VALUES (?, ?, ?)", uint16(65535), uint32(4000000000), max); err != nil {
+		t.Fatal(err)
+	}
+	var a uint16
+	var b uint32
+	var c uint64
+	if err = db.QueryRow("SELECT a, b, c FROM #ubind WHERE c = ?", max).Scan(&a, &b, &c); err != nil {
+		t.Fatal(err)
+	}
+	if a != 65535 || b != 4000000000 || c != max {
+		t.Fatalf("unexpected unsigned values %d, %d and %d", a, b, c)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := Capabilities()
+	if caps.APIVersion < API_VERSION_1 {
+		t.Fatalf("unexpected API version %d", caps.APIVersion)
+	}
+	if caps.ClientVersion == "" || strings.Count(caps.ClientVersion, ".") != 3 {
+		t.Fatalf("unexpected client version %q", caps.ClientVersion)
+	}
+	if caps.APIVersion > API_VERSION_5 {
+		t.Fatalf("expected the API to be initialized with at most version %d, got %d", API_VERSION_5, caps.APIVersion)
+	}
+	if caps.Cancel != (caps.APIVersion >= API_VERSION_2) {
+		t.Fatalf("unexpected cancel support for API version %d", caps.APIVersion)
+	}
+}
+
+func TestTinyInt(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE #tiny (a TINYINT, b TINYINT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO #tiny VALUES (?, ?)", 200, uint8(255)); err != nil {
+		t.Fatal(err)
+	}
+	var a, b interface{}
+	if err := db.QueryRow("SELECT a, b FROM #tiny").Scan(&a, &b); err != nil {
+		t.Fatal(err)
+	}
+	if a != uint8(200) || b != uint8(255) {
+		t.Fatalf("expected 200 and 255, got %v (%T) and %v (%T)", a, a, b, b)
+	}
+	var n int
+	if err := db.QueryRow("SELECT a FROM #tiny").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 200 {
+		t.Fatalf("expected 200, got %d", n)
+	}
+}
+
+func TestUseDatabase(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		ctx := context.Background()
+		current, err := cn.Scalar(ctx, "SELECT db_name()")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cn.UseDatabase("nosuchdatabase"); err == nil {
+			t.Fatal("expected an error switching to a database which does not exist")
+		}
+		// still connected to the original database
+		if _, err = cn.Scalar(ctx, "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+
+		before, err := cn.Scalar(ctx, "SELECT connection_property('Number')")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cn.UseDatabase(fmt.Sprint(current)); err != nil {
+			t.Fatal(err)
+		}
+		name, err := cn.Scalar(ctx, "SELECT db_name()")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != current {
+			t.Fatalf("expected database %v, got %v", current, name)
+		}
+		after, err := cn.Scalar(ctx, "SELECT connection_property('Number')")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if before == after {
+			t.Fatal("expected the connection to be re-established")
+		}
+	})
+}
+
+func TestDefaultIsolation(t *testing.T) {
+	admin := openTestConn(t)
+	defer admin.Close()
+	var prev string
+	err := admin.QueryRow(`SELECT setting FROM SYS.SYSOPTIONS WHERE user_name = 'PUBLIC' AND "option" = 'allow_snapshot_isolation'`).Scan(&prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = admin.Exec("SET OPTION PUBLIC.allow_snapshot_isolation = 'On'"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := admin.Exec("SET OPTION PUBLIC.allow_snapshot_isolation = " + QuoteLiteral(prev)); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	db, err := sql.Open(DriverName, testDSN+";isolation=snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var level string
+	if err = db.QueryRow("SELECT connection_property('isolation_level')").Scan(&level); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.EqualFold(level, "snapshot") {
+		t.Fatalf("expected snapshot isolation, got %q", level)
+	}
+}
+
+func TestStmtAcrossTx(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		if err := cn.ExecScript(context.Background(), "CREATE TABLE #txins (a INT)"); err != nil {
+			t.Fatal(err)
+		}
+		st, err := cn.Prepare("INSERT INTO #txins VALUES (?)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := cn.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			if _, err = st.Exec([]driver.Value{int64(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		// still usable after the transaction
+		if _, err = st.Exec([]driver.Value{int64(100)}); err != nil {
+			t.Fatal(err)
+		}
+		st.Close()
+		if _, err = st.Exec([]driver.Value{int64(101)}); err != errStmtClosed {
+			t.Fatalf("expected errStmtClosed, got %v", err)
+		}
+		v, err := cn.Scalar(context.Background(), "SELECT count(*) FROM #txins")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := fmt.Sprint(v); s != "101" {
+			t.Fatalf("expected 101 rows, got %s", s)
+		}
+	})
+}
+
+func TestConnStats(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	withConn(t, db, func(cn *conn) {
+		if err := cn.ResetSession(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		before, err := cn.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs := rawQuery(t, cn, "SELECT row_num FROM sa_rowgenerator(1, 5)")
+		dest := make([]driver.Value, 1)
+		for rs.Next(dest) == nil {
+		}
+		rs.Close()
+		rs.st.Close()
+		after, err := cn.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Queries != before.Queries+1 || after.RowsFetched != before.RowsFetched+5 {
+			t.Fatalf("unexpected counters: %+v before, %+v after", before, after)
+		}
+		if after.BytesSent <= before.BytesSent || after.BytesReceived <= before.BytesReceived {
+			t.Fatalf("expected the byte counts to advance: %+v before, %+v after", before, after)
+		}
+
+		if err = cn.ResetSession(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if stats, _ := cn.Stats(); stats.Queries != 0 || stats.RowsFetched != 0 {
+			t.Fatalf("expected the counters to be reset, got %+v", stats)
+		}
+	})
+}
+
 func TestExecerInterface(t *testing.T) {
 	// Gin up a straw man private struct just for the type check
 	cn := &conn{cn: 0}
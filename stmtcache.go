@@ -0,0 +1,163 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// prepared statement cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Idle prepared statements of a connection keyed by query.
+//
+// Statements are checked out of the cache by Prepare and returned to it
+// by Close so a statement handle is never used by two callers at the
+// same time. The statement handles belong to the native connection so
+// the cache is freed with it - what outlives the connection is the
+// metadata kept in the connector's metaCache.
+type stmtCache struct {
+	size  int
+	lru   *list.List // of *stmt, most recently used at the front
+	stmts map[string]*list.Element
+
+	// for tests
+	hits, misses int
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:  size,
+		lru:   list.New(),
+		stmts: make(map[string]*list.Element),
+	}
+}
+
+// Checks out the idle statement prepared for query.
+// Returns nil if there's none.
+func (c *stmtCache) get(query string) *stmt {
+	e, ok := c.stmts[query]
+	if !ok {
+		c.misses++
+		return nil
+	}
+	c.hits++
+	c.lru.Remove(e)
+	delete(c.stmts, query)
+	cached := e.Value.(*stmt)
+	// a fresh stmt so that a stale reference to the previous one can't
+	// close it on behalf of the new owner
+	return &stmt{
+		cn:          cached.cn,
+		st:          cached.st,
+		query:       cached.query,
+		cols:        cached.cols,
+		meta:        cached.meta,
+		described:   cached.described,
+		numparams:   cached.numparams,
+		forwardOnly: cached.forwardOnly,
+		generation:  cached.generation,
+	}
+}
+
+// Returns the statement to the cache evicting (and freeing) the least
+// recently used ones if the cache is full. Returns the queries of the
+// evicted statements.
+func (c *stmtCache) put(st *stmt) (evicted []string) {
+	if _, ok := c.stmts[st.query]; ok {
+		// the same query has been prepared more than once - one idle
+		// statement is enough
+		st.st.free()
+		return nil
+	}
+	c.stmts[st.query] = c.lru.PushFront(st)
+	for c.lru.Len() > c.size {
+		e := c.lru.Back()
+		lru := c.lru.Remove(e).(*stmt)
+		delete(c.stmts, lru.query)
+		lru.st.free()
+		evicted = append(evicted, lru.query)
+	}
+	return evicted
+}
+
+// Result set columns of a query shared by the connections of a
+// connector (see metaCache)
+type stmtMeta struct {
+	cols []string
+	meta []ColumnMeta
+}
+
+// Column metadata of the most recently prepared queries keyed by query.
+// Shared by all connections of a connector so that a query prepared on a
+// new (or another) connection is not described again - the statement
+// itself is prepared on each connection as it is used there.
+type metaCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // of *metaEntry, most recently used at the front
+	entries map[string]*list.Element
+
+	// for tests
+	hits, misses int
+}
+
+type metaEntry struct {
+	query string
+	stmtMeta
+}
+
+func newMetaCache(size int) *metaCache {
+	return &metaCache{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Returns the metadata of query if it has been described on any of the
+// connections. ok is false if there's none (or no cache).
+func (c *metaCache) get(query string) (m stmtMeta, ok bool) {
+	if c == nil {
+		return m, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[query]
+	if !ok {
+		c.misses++
+		return m, false
+	}
+	c.hits++
+	c.lru.MoveToFront(e)
+	return e.Value.(*metaEntry).stmtMeta, true
+}
+
+// Records the metadata of query evicting the least recently used
+// entries if the cache is full
+func (c *metaCache) put(query string, m stmtMeta) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[query]; ok {
+		e.Value.(*metaEntry).stmtMeta = m
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[query] = c.lru.PushFront(&metaEntry{query: query, stmtMeta: m})
+	for c.lru.Len() > c.size {
+		lru := c.lru.Remove(c.lru.Back()).(*metaEntry)
+		delete(c.entries, lru.query)
+	}
+}
+
+// Frees all idle statements
+func (c *stmtCache) clear() {
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		e.Value.(*stmt).st.free()
+	}
+	c.lru.Init()
+	c.stmts = make(map[string]*list.Element)
+}
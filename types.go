@@ -0,0 +1,47 @@
+// vim:ts=4:sw=4:et
+
+package sqlany
+
+// custom parameter and column types
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Geometry holds a spatial value (ST_Geometry and its subtypes) in the
+// well-known binary (WKB) representation to be parsed with a geometry
+// library of choice.
+//
+// Spatial columns are described by the server as LONG BINARY so they're
+// returned as []byte like any other binary column - scan them into a
+// *Geometry to have them typed. The server's default binary format for
+// spatial values (the st_geometry_asbinary_format option) is WKB.
+type Geometry []byte
+
+// Value implements driver.Valuer - spatial values are bound as binary
+// WKB which the server converts to the type of the target
+func (g Geometry) Value() (driver.Value, error) {
+	if g == nil {
+		return nil, nil
+	}
+	return []byte(g), nil
+}
+
+// Scan implements sql.Scanner
+func (g *Geometry) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*g = nil
+	case []byte:
+		*g = append((*g)[:0], v...)
+	default:
+		return fmt.Errorf("sqla: cannot scan %T into Geometry", src)
+	}
+	return nil
+}
+
+// RowID identifies a row of a table as returned by the ROWID function,
+// e.g. SELECT ROWID(items), name FROM items (see UpdateLOB). It stays
+// valid until the row is deleted or the table is reorganized.
+type RowID uint64